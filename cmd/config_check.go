@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/service"
+)
+
+// runConfigCommand menjalankan subcommand "config", saat ini hanya "config check"
+func runConfigCommand(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: app config check [-file path] [-print]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	file := fs.String("file", os.Getenv("CONFIG_FILE"), "config file (.yaml, .yml or .toml)")
+	printConfig := fs.Bool("print", false, "print the effective configuration with secrets redacted")
+	fs.Parse(args[1:])
+
+	cfg, err := config.Load(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	// template tenant ikut diperiksa agar kesalahan sintaks ketahuan sebelum deploy
+	if _, err := service.NewTemplateRegistry(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Email templates are invalid:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		out, _ := json.MarshalIndent(redactedConfig(cfg), "", "  ")
+		fmt.Println(string(out))
+	}
+	fmt.Printf("Configuration OK: %d tenant(s), %d program(s)\n", len(cfg.Tenants), len(cfg.Programs))
+}
+
+// redactedConfig adalah tampilan konfigurasi yang aman ditulis: field log:"secret" diganti [REDACTED]
+// dan PII disamarkan. Dipakai oleh "config check -print" dan log saat server mulai.
+func redactedConfig(cfg *config.Config) interface{} {
+	return logger.Redact(cfg)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/service"
+)
+
+// runDeadLetters menjalankan subcommand "dead-letters list|requeue" untuk memeriksa
+// atau mengirim ulang pesan di dead letter queue email
+func runDeadLetters(cfg *config.Config, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "requeue") {
+		return errors.New("usage: app dead-letters list|requeue [-limit n]")
+	}
+
+	fs := flag.NewFlagSet("dead-letters "+args[0], flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "maximum number of messages to list or requeue")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	rmqUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/", cfg.RabbitMqUser, cfg.RabbitMqPassword, cfg.RabbitMqHost, cfg.RabbitMqPort)
+	rabbitMQ, err := service.NewRabbitMQService(rmqUrl, cfg.RabbitMqExchange, cfg.RabbitMqQueue, cfg.RabbitMqBindingKeys, service.NewRetryPolicy(cfg), logger.NewLogger())
+	if err != nil {
+		return fmt.Errorf("could not initialize RabbitMQ: %w", err)
+	}
+	defer rabbitMQ.Close()
+
+	ctx := context.Background()
+	if args[0] == "requeue" {
+		moved, err := rabbitMQ.RequeueDeadLetters(ctx, *limit)
+		fmt.Printf("Requeued %d message(s)\n", moved)
+		if err != nil {
+			return fmt.Errorf("requeue failed: %w", err)
+		}
+		return nil
+	}
+
+	letters, err := rabbitMQ.DeadLetters(ctx, *limit)
+	if err != nil {
+		return fmt.Errorf("could not read dead letters: %w", err)
+	}
+	out, _ := json.MarshalIndent(letters, "", "  ")
+	fmt.Fprintln(os.Stdout, string(out))
+	return nil
+}
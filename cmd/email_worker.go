@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/service"
+)
+
+// runEmailWorker menjalankan subcommand "email-worker": membaca queue email dan mengirimnya lewat SMTP
+// sampai menerima SIGINT/SIGTERM. Pesan yang sedang dikirim diselesaikan dulu sebelum koneksi ditutup.
+func runEmailWorker(cfg *config.Config) error {
+	logger := logger.NewLogger()
+	defer logger.Sync()
+
+	mailer, err := service.NewSMTPMailer(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP configuration: %w", err)
+	}
+
+	rmqUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/", cfg.RabbitMqUser, cfg.RabbitMqPassword, cfg.RabbitMqHost, cfg.RabbitMqPort)
+	rabbitMQ, err := service.NewRabbitMQService(rmqUrl, cfg.RabbitMqExchange, cfg.RabbitMqQueue, cfg.RabbitMqBindingKeys, service.NewRetryPolicy(cfg), logger)
+	if err != nil {
+		return fmt.Errorf("could not initialize RabbitMQ: %w", err)
+	}
+
+	db, err := database.ConnectMongoDB(cfg)
+	if err != nil {
+		rabbitMQ.Close()
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	templates, err := service.NewTemplateRegistry(cfg)
+	if err != nil {
+		rabbitMQ.Close()
+		db.Client.Disconnect(context.Background())
+		return fmt.Errorf("failed to load email templates: %w", err)
+	}
+
+	worker := service.NewEmailWorker(db, rabbitMQ, mailer, templates, cfg, logger)
+	worker.Run(ctx)
+	logger.Info("Email worker stopped")
+
+	shutdownTimeout, _ := time.ParseDuration(cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	rabbitMQ.Close()
+	if err := db.Client.Disconnect(shutdownCtx); err != nil {
+		logger.Error("Failed to disconnect MongoDB", zap.Error(err))
+	}
+	return nil
+}
@@ -2,18 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 
 	"webhook-listener-mekarisign/config"
 	"webhook-listener-mekarisign/database"
 	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/metrics"
 	"webhook-listener-mekarisign/router"
 	"webhook-listener-mekarisign/service"
+	"webhook-listener-mekarisign/tracing"
 )
 
 func main() {
@@ -23,44 +33,185 @@ func main() {
 	}
 	log.Println("App ver 1.0-rc")
 
+	// Subcommand config dijalankan sebelum LoadConfig agar error validasi bisa ditampilkan tanpa menghentikan proses
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfigCommand(os.Args[2:])
+		return
+	}
+
 	// Load config
 	cfg := config.LoadConfig()
+	if err := logger.Init(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatalf("Could not initialize logger: %v", err)
+	}
+
+	// Tracing OpenTelemetry, no-op kecuali tracing_exporter otlp
+	shutdownTracing, err := tracing.Init(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Could not initialize tracing: %v", err)
+	}
+
+	// Subcommand selain server. Trace di-flush sebelum keluar, termasuk saat subcommand gagal.
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "reconcile":
+			err = runReconcile(cfg, os.Args[2:])
+		case "email-worker":
+			err = runEmailWorker(cfg)
+		case "dead-letters":
+			err = runDeadLetters(cfg, os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command: %s", os.Args[1])
+		}
+		if serr := shutdownTracing(context.Background()); serr != nil {
+			log.Printf("Failed to flush traces: %v", serr)
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
 
 	// Setup logger
 	logger := logger.NewLogger()
 	defer logger.Sync()
 
 	// Print config
-	logger.Info("Config", zap.Any("config", cfg))
+	logger.Info("Config", zap.Any("config", redactedConfig(cfg)))
+
+	// ctx selesai saat menerima SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Inisialisasi RabbitMQ
 	rmqUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/", cfg.RabbitMqUser, cfg.RabbitMqPassword, cfg.RabbitMqHost, cfg.RabbitMqPort)
-	rabbitMQ, err := service.NewRabbitMQService(rmqUrl, cfg.RabbitMqQueue)
+	rabbitMQ, err := service.NewRabbitMQService(rmqUrl, cfg.RabbitMqExchange, cfg.RabbitMqQueue, cfg.RabbitMqBindingKeys, service.NewRetryPolicy(cfg), logger)
 	if err != nil {
 		log.Fatalf("Could not initialize RabbitMQ: %v", err)
 	} else {
 		log.Println("Connected to RabbitMQ")
 	}
-	defer rabbitMQ.Close()
 
 	// Connect to MongoDB
 	db, err := database.ConnectMongoDB(cfg)
 	if err != nil {
 		logger.Fatal("Failed to connect to MongoDB", zap.Error(err))
 	}
-	defer db.Client.Disconnect(context.Background())
+	if err := service.EnsureIndexes(ctx, db); err != nil {
+		logger.Fatal("Failed to create MongoDB indexes", zap.Error(err))
+	}
 
 	// Connect to MySQL
 	database.ConnectMySQL(cfg)
-	defer database.DB.Close()
+
+	// Worker latar belakang berhenti saat workerCtx dibatalkan ketika shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	// Pengaturan bisnis dibaca dari MongoDB dan dimuat ulang berkala
+	settings := service.NewSettingsService(db, cfg, logger)
+	if err := settings.Reload(ctx); err != nil {
+		logger.Fatal("Failed to load settings", zap.Error(err))
+	}
+	reloadInterval, _ := time.ParseDuration(cfg.SettingsReloadInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		settings.Watch(workerCtx, reloadInterval)
+	}()
+
+	// Relay outbox mengirim email dan WhatsApp yang dicatat saat memproses webhook
+	outbox := service.NewOutboxService(db, rabbitMQ, cfg, logger)
+	relayInterval, _ := time.ParseDuration(cfg.OutboxRelayInterval)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		outbox.Run(workerCtx, relayInterval)
+	}()
+
+	// Template email di-parse sekali saat startup
+	templates, err := service.NewTemplateRegistry(cfg)
+	if err != nil {
+		logger.Fatal("Failed to load email templates", zap.Error(err))
+	}
+
+	// Notifikasi staf bisa dikumpulkan menjadi digest harian
+	notifications := service.NewNotificationService(db, outbox, cfg)
+	staff := service.NewStaffNotificationService(db, notifications, templates, cfg, logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		staff.Run(workerCtx)
+	}()
+
+	// Metrics Prometheus di listener terpisah, gauge antrean dihitung dari MongoDB saat di-scrape
+	prometheus.MustRegister(service.NewQueueMetrics(db, logger))
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	metricsServer := &http.Server{Addr: ":" + cfg.MetricsPort, Handler: metricsMux}
+	go func() {
+		logger.Info("Metrics server running", zap.String("port", cfg.MetricsPort))
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed", zap.Error(err))
+		}
+	}()
 
 	// Setup Echo server
 	e := echo.New()
-	router.SetupRoutes(e, db, cfg, rabbitMQ)
+	router.SetupRoutes(e, db, cfg, templates, rabbitMQ, settings, notifications, staff, logger)
 
 	// Start server
-	logger.Info("Server running", zap.String("port", cfg.ServerPort))
-	if err := e.Start(":" + cfg.ServerPort); err != nil {
-		logger.Fatal("Server failed", zap.Error(err))
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server running", zap.String("port", cfg.ServerPort))
+		if err := e.Start(":" + cfg.ServerPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received, draining in-flight requests")
+	case err := <-serverErr:
+		logger.Error("Server failed", zap.Error(err))
+	}
+
+	// Tunggu request yang sedang berjalan selesai (invoice, ledger, email) sebelum menutup koneksi
+	shutdownTimeout, _ := time.ParseDuration(cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Server did not shut down cleanly", zap.Error(err))
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Metrics server did not shut down cleanly", zap.Error(err))
 	}
+
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("Background workers did not stop before shutdown timeout")
+	}
+
+	// Tutup koneksi berurutan: publisher dulu, lalu database
+	rabbitMQ.Close()
+	if err := db.Client.Disconnect(shutdownCtx); err != nil {
+		logger.Error("Failed to disconnect MongoDB", zap.Error(err))
+	}
+	if err := database.DB.Close(); err != nil {
+		logger.Error("Failed to close MySQL", zap.Error(err))
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
+
+	logger.Info("Shutdown complete")
 }
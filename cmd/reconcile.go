@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/handler"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/service"
+)
+
+// runReconcile mencocokkan invoice Xendit dengan callback yang tersimpan.
+// Tanpa -interval dijalankan sekali, dengan -interval dijalankan berkala sampai proses dihentikan.
+func runReconcile(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	lookback := fs.Duration("lookback", 30*24*time.Hour, "only check invoices created within this window")
+	interval := fs.Duration("interval", 0, "run periodically with this interval (0 = run once)")
+	dryRun := fs.Bool("dry-run", false, "report discrepancies without processing missing callbacks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger := logger.NewLogger()
+	defer logger.Sync()
+
+	rmqUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/", cfg.RabbitMqUser, cfg.RabbitMqPassword, cfg.RabbitMqHost, cfg.RabbitMqPort)
+	rabbitMQ, err := service.NewRabbitMQService(rmqUrl, cfg.RabbitMqExchange, cfg.RabbitMqQueue, cfg.RabbitMqBindingKeys, service.NewRetryPolicy(cfg), logger)
+	if err != nil {
+		return fmt.Errorf("could not initialize RabbitMQ: %w", err)
+	}
+	defer rabbitMQ.Close()
+
+	db, err := database.ConnectMongoDB(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client.Disconnect(context.Background())
+	if err := service.EnsureIndexes(context.Background(), db); err != nil {
+		return fmt.Errorf("failed to create MongoDB indexes: %w", err)
+	}
+
+	database.ConnectMySQL(cfg)
+	defer database.DB.Close()
+
+	settings := service.NewSettingsService(db, cfg, logger)
+	if err := settings.Reload(context.Background()); err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	// SIGINT/SIGTERM menghentikan loop setelah tenant yang sedang diproses selesai
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	templates, err := service.NewTemplateRegistry(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load email templates: %w", err)
+	}
+
+	outbox := service.NewOutboxService(db, rabbitMQ, cfg, logger)
+	notifications := service.NewNotificationService(db, outbox, cfg)
+	h := handler.NewWebhookHandler(db, service.NewTenantXenditServices(cfg), cfg, templates, notifications, service.NewStaffNotificationService(db, notifications, templates, cfg, logger), service.NewReceiptService(db, templates, cfg), service.NewLedgerService(db), service.NewPricingService(db, cfg, settings), settings)
+
+	for {
+		for i := range cfg.Tenants {
+			if ctx.Err() != nil {
+				logger.Info("Reconciliation interrupted")
+				return nil
+			}
+			tenant := &cfg.Tenants[i]
+			report, err := h.Reconcile(context.Background(), tenant, time.Now().Add(-*lookback), *dryRun)
+			if err != nil {
+				logger.Error("Reconciliation failed", zap.String("tenant", tenant.ID), zap.Error(err))
+				continue
+			}
+
+			out, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Fprintln(os.Stdout, string(out))
+			logger.Info("Reconciliation finished",
+				zap.String("tenant", tenant.ID),
+				zap.Int("checked", report.Checked),
+				zap.Int("discrepancies", len(report.Discrepancies)))
+		}
+
+		// kirim email dan WhatsApp dari callback yang diproses ulang, sisanya dicoba ulang oleh relay server
+		if sent := outbox.DeliverDue(ctx); sent > 0 {
+			logger.Info("Outbox messages delivered", zap.Int("sent", sent))
+		}
+
+		if *interval <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("Reconciliation stopped")
+			return nil
+		case <-time.After(*interval):
+		}
+		if err := settings.Reload(context.Background()); err != nil {
+			logger.Error("Failed to reload settings", zap.Error(err))
+		}
+	}
+}
@@ -1,59 +1,105 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strings"
 )
 
+// Config berisi seluruh konfigurasi aplikasi. Nilai diambil berurutan dari tag default,
+// file konfigurasi (YAML/TOML) lalu environment variable pada tag env.
+// Field bertag log:"secret" tidak pernah ditulis ke log.
 type Config struct {
-	DatabaseURL                string
-	DatabaseName               string
-	Collection                 string
-	ServerPort                 string
-	XenditSecretKey            string
-	XenditPublicKey            string
-	XenditCallbackURL          string
-	XenditInvDuration          string
-	XenditCallbackToken        string
-	DirectorName               string
-	DirectorMail               string
-	RabbitMqHost               string
-	RabbitMqPort               string
-	RabbitMqUser               string
-	RabbitMqPassword           string
-	RabbitMqQueue              string
-	WhatsappToken              string
-	WhatsappNotificationNumber string
-	DatabaseMysqlHost          string
-	DatabaseMysqlPort          string
-	DatabaseMysqlUser          string
-	DatabaseMysqlPassword      string
-	DatabaseMysqlDatabase      string
+	DatabaseURL                string   `yaml:"database_url" toml:"database_url" env:"DATABASE_URL" validate:"required,url" log:"secret"`
+	DatabaseName               string   `yaml:"database_name" toml:"database_name" env:"DB_NAME" validate:"required"`
+	Collection                 string   `yaml:"collection" toml:"collection" env:"COLLECTION_NAME"`
+	ServerPort                 string   `yaml:"server_port" toml:"server_port" env:"SERVER_PORT" default:"3000" validate:"required,port"`
+	MetricsPort                string   `yaml:"metrics_port" toml:"metrics_port" env:"METRICS_PORT" default:"2112" validate:"port"` // listener terpisah untuk /metrics, tidak dibuka ke publik
+	XenditSecretKey            string   `yaml:"xendit_secret_key" toml:"xendit_secret_key" env:"XENDIT_SECRET_KEY" log:"secret"`
+	XenditPublicKey            string   `yaml:"xendit_public_key" toml:"xendit_public_key" env:"XENDIT_PUBLIC_KEY"`
+	XenditCallbackURL          string   `yaml:"xendit_callback_url" toml:"xendit_callback_url" env:"XENDIT_CALLBACK_URL" validate:"url"`
+	XenditInvDuration          string   `yaml:"invoice_duration" toml:"invoice_duration" env:"INVOICE_DURATION" default:"432000" validate:"required,number"`
+	XenditCallbackToken        string   `yaml:"xendit_callback_token" toml:"xendit_callback_token" env:"XENDIT_CALLBACK_TOKEN" log:"secret"`
+	DirectorName               string   `yaml:"director_name" toml:"director_name" env:"DIRECTOR_NAME"`
+	DirectorMail               string   `yaml:"director_email" toml:"director_email" env:"DIRECTOR_EMAIL" validate:"emails"`
+	RabbitMqHost               string   `yaml:"rabbitmq_host" toml:"rabbitmq_host" env:"RABBITMQ_HOST" validate:"required"`
+	RabbitMqPort               string   `yaml:"rabbitmq_port" toml:"rabbitmq_port" env:"RABBITMQ_PORT" default:"5672" validate:"required,port"`
+	RabbitMqUser               string   `yaml:"rabbitmq_user" toml:"rabbitmq_user" env:"RABBITMQ_USER" validate:"required"`
+	RabbitMqPassword           string   `yaml:"rabbitmq_password" toml:"rabbitmq_password" env:"RABBITMQ_PASSWORD" validate:"required" log:"secret"`
+	RabbitMqQueue              string   `yaml:"rabbitmq_queue" toml:"rabbitmq_queue" env:"RABBITMQ_QUEUE_NAME" validate:"required"`
+	RabbitMqExchange           string   `yaml:"rabbitmq_exchange" toml:"rabbitmq_exchange" env:"RABBITMQ_EXCHANGE" default:"notifications" validate:"required"`
+	RabbitMqBindingKeys        []string `yaml:"rabbitmq_binding_keys" toml:"rabbitmq_binding_keys" env:"RABBITMQ_BINDING_KEYS" default:"notify.email.#"`
+	RabbitMqMaxRetries         string   `yaml:"rabbitmq_max_retries" toml:"rabbitmq_max_retries" env:"RABBITMQ_MAX_RETRIES" default:"5" validate:"number"`
+	RabbitMqRetryDelay         string   `yaml:"rabbitmq_retry_delay" toml:"rabbitmq_retry_delay" env:"RABBITMQ_RETRY_DELAY" default:"10s" validate:"duration"`
+	SMTPHost                   string   `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort                   string   `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT" default:"587" validate:"port"`
+	SMTPUser                   string   `yaml:"smtp_user" toml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword               string   `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" log:"secret"`
+	SMTPFrom                   string   `yaml:"smtp_from" toml:"smtp_from" env:"SMTP_FROM" validate:"emails"`
+	SMTPTLS                    string   `yaml:"smtp_tls" toml:"smtp_tls" env:"SMTP_TLS" default:"starttls" validate:"oneof=starttls|tls|none"`
+	WhatsappToken              string   `yaml:"whatsapp_token" toml:"whatsapp_token" env:"WHATSAPP_TOKEN" log:"secret"`
+	WhatsappNotificationNumber string   `yaml:"whatsapp_notification_number" toml:"whatsapp_notification_number" env:"WHATSAPP_NOTIFICATION_NUMBER" validate:"phone"`
+	DatabaseMysqlHost          string   `yaml:"mysql_host" toml:"mysql_host" env:"DB_MySQL_HOST" validate:"required"`
+	DatabaseMysqlPort          string   `yaml:"mysql_port" toml:"mysql_port" env:"DB_MySQL_PORT" default:"3306" validate:"required,port"`
+	DatabaseMysqlUser          string   `yaml:"mysql_user" toml:"mysql_user" env:"DB_MySQL_USER" validate:"required"`
+	DatabaseMysqlPassword      string   `yaml:"mysql_password" toml:"mysql_password" env:"DB_MySQL_PASSWORD" log:"secret"`
+	DatabaseMysqlDatabase      string   `yaml:"mysql_database" toml:"mysql_database" env:"DB_MySQL_DATABASE" validate:"required"`
+	AdminAPIKey                string   `yaml:"admin_api_key" toml:"admin_api_key" env:"ADMIN_API_KEY" log:"secret"`
+	AdminAPIKeys               []string `yaml:"admin_api_keys" toml:"admin_api_keys" env:"ADMIN_API_KEYS" log:"secret"` // format nama:key, nama dicatat di audit trail
+	InvoiceAPIKeys             []string `yaml:"invoice_api_keys" toml:"invoice_api_keys" env:"INVOICE_API_KEYS" log:"secret"`
+	ProgramsFile               string   `yaml:"programs_file" toml:"programs_file" env:"PROGRAMS_CONFIG_FILE"`
+	TenantsFile                string   `yaml:"tenants_file" toml:"tenants_file" env:"TENANTS_CONFIG_FILE"`
+	LogLevel                   string   `yaml:"log_level" toml:"log_level" env:"LOG_LEVEL" default:"info" validate:"oneof=debug|info|warn|error"`
+	LogFormat                  string   `yaml:"log_format" toml:"log_format" env:"LOG_FORMAT" default:"json" validate:"oneof=json|console"`
+	TracingExporter            string   `yaml:"tracing_exporter" toml:"tracing_exporter" env:"OTEL_TRACES_EXPORTER" default:"none" validate:"oneof=none|otlp"`
+	TracingEndpoint            string   `yaml:"tracing_endpoint" toml:"tracing_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" validate:"url"`
+	TracingServiceName         string   `yaml:"tracing_service_name" toml:"tracing_service_name" env:"OTEL_SERVICE_NAME" default:"webhook-listener-mekarisign"`
+	HealthCheckXendit          string   `yaml:"health_check_xendit" toml:"health_check_xendit" env:"HEALTH_CHECK_XENDIT" default:"false" validate:"oneof=true|false"`
+	ShutdownTimeout            string   `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s" validate:"duration"`
+	SettingsReloadInterval     string   `yaml:"settings_reload_interval" toml:"settings_reload_interval" env:"SETTINGS_RELOAD_INTERVAL" default:"30s" validate:"duration"`
+	OutboxRelayInterval        string   `yaml:"outbox_relay_interval" toml:"outbox_relay_interval" env:"OUTBOX_RELAY_INTERVAL" default:"5s" validate:"duration"`
+	OutboxMaxAttempts          string   `yaml:"outbox_max_attempts" toml:"outbox_max_attempts" env:"OUTBOX_MAX_ATTEMPTS" default:"10" validate:"number"`
+	PublicBaseURL              string   `yaml:"public_base_url" toml:"public_base_url" env:"PUBLIC_BASE_URL" validate:"url"`
+	AttachmentURLPrefixes      []string `yaml:"attachment_url_prefixes" toml:"attachment_url_prefixes" env:"ATTACHMENT_URL_PREFIXES"` // selain public_base_url, lampiran email hanya diunduh dari URL berawalan ini
+	StaffDigestTime            string   `yaml:"staff_digest_time" toml:"staff_digest_time" env:"STAFF_DIGEST_TIME" default:"08:00" validate:"clock"`
+	StaffNotificationEmails    string   `yaml:"staff_notification_emails" toml:"staff_notification_emails" env:"STAFF_NOTIFICATION_EMAILS" validate:"emails"`
+
+	Programs           map[string]ProgramConfig `yaml:"programs" toml:"programs"`
+	Tenants            []Tenant                 `yaml:"tenants" toml:"tenants"`
+	Notifications      NotificationRules        `yaml:"notifications" toml:"notifications"`
+	StaffNotifications StaffNotifications       `yaml:"staff_notifications" toml:"staff_notifications"`
 }
 
+// LoadConfig memuat konfigurasi dari file pada CONFIG_FILE (opsional) dan environment.
+// Proses dihentikan dengan daftar kesalahan jika konfigurasi tidak valid.
 func LoadConfig() *Config {
-	return &Config{
-		DatabaseURL:                os.Getenv("DATABASE_URL"),
-		DatabaseName:               os.Getenv("DB_NAME"),
-		Collection:                 os.Getenv("COLLECTION_NAME"),
-		ServerPort:                 os.Getenv("SERVER_PORT"),
-		XenditSecretKey:            os.Getenv("XENDIT_SECRET_KEY"),
-		XenditPublicKey:            os.Getenv("XENDIT_PUBLIC_KEY"),
-		XenditCallbackURL:          os.Getenv("XENDIT_CALLBACK_URL"),
-		XenditInvDuration:          os.Getenv("INVOICE_DURATION"),
-		XenditCallbackToken:        os.Getenv("XENDIT_CALLBACK_TOKEN"),
-		DirectorName:               os.Getenv("DIRECTOR_NAME"),
-		DirectorMail:               os.Getenv("DIRECTOR_EMAIL"),
-		RabbitMqHost:               os.Getenv("RABBITMQ_HOST"),
-		RabbitMqPort:               os.Getenv("RABBITMQ_PORT"),
-		RabbitMqUser:               os.Getenv("RABBITMQ_USER"),
-		RabbitMqPassword:           os.Getenv("RABBITMQ_PASSWORD"),
-		RabbitMqQueue:              os.Getenv("RABBITMQ_QUEUE_NAME"),
-		WhatsappToken:              os.Getenv("WHATSAPP_TOKEN"),
-		WhatsappNotificationNumber: os.Getenv("WHATSAPP_NOTIFICATION_NUMBER"),
-		DatabaseMysqlHost:          os.Getenv("DB_MySQL_HOST"),
-		DatabaseMysqlPort:          os.Getenv("DB_MySQL_PORT"),
-		DatabaseMysqlUser:          os.Getenv("DB_MySQL_USER"),
-		DatabaseMysqlPassword:      os.Getenv("DB_MySQL_PASSWORD"),
-		DatabaseMysqlDatabase:      os.Getenv("DB_MySQL_DATABASE"),
+	cfg, err := Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	return cfg
+}
+
+// splitList memecah nilai env yang dipisahkan koma, mengabaikan elemen kosong
+func splitList(value string) []string {
+	var result []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// AdminKeys mengembalikan key admin per orang (key -> nama) dari ADMIN_API_KEYS.
+// Entri yang tidak berformat nama:key diabaikan, kesalahannya dilaporkan oleh Validate.
+func (c *Config) AdminKeys() map[string]string {
+	keys := make(map[string]string, len(c.AdminAPIKeys))
+	for _, entry := range c.AdminAPIKeys {
+		name, key, ok := strings.Cut(entry, ":")
+		if name = strings.TrimSpace(name); ok && name != "" && key != "" {
+			keys[key] = name
+		}
 	}
+	return keys
 }
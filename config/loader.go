@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Load membaca konfigurasi dengan urutan prioritas: nilai default, file (YAML/TOML, opsional),
+// lalu environment variable. Error yang dikembalikan bertipe ValidationErrors jika ada field tidak valid.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	applyDefaults(cfg)
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	applyEnv(cfg)
+
+	var errs ValidationErrors
+	if cfg.ProgramsFile != "" {
+		var programs map[string]ProgramConfig
+		if err := readJSONFile(cfg.ProgramsFile, &programs); err != nil {
+			errs = append(errs, fmt.Sprintf("programs_file: %v", err))
+		} else {
+			cfg.Programs = programs
+		}
+	}
+	if len(cfg.Programs) == 0 {
+		cfg.Programs = DefaultPrograms
+	}
+
+	if cfg.TenantsFile != "" {
+		var tenants []Tenant
+		if err := readJSONFile(cfg.TenantsFile, &tenants); err != nil {
+			errs = append(errs, fmt.Sprintf("tenants_file: %v", err))
+		} else {
+			cfg.Tenants = tenants
+		}
+	}
+	if len(cfg.Tenants) == 0 {
+		cfg.Tenants = []Tenant{legacyTenant(cfg)}
+	}
+	applyNotificationDefaults(cfg)
+
+	errs = append(errs, cfg.Validate()...)
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+// loadFile membaca file konfigurasi, format ditentukan dari ekstensi file
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyDefaults mengisi field dengan tag default
+func applyDefaults(cfg *Config) {
+	forEachField(cfg, func(field reflect.StructField, value reflect.Value) {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			setValue(value, def)
+		}
+	})
+}
+
+// applyEnv menimpa field dengan environment variable pada tag env jika env tersebut tidak kosong
+func applyEnv(cfg *Config) {
+	forEachField(cfg, func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		if env := os.Getenv(name); env != "" {
+			setValue(value, env)
+		}
+	})
+}
+
+func forEachField(cfg *Config, fn func(reflect.StructField, reflect.Value)) {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fn(t.Field(i), v.Field(i))
+	}
+}
+
+func setValue(value reflect.Value, raw string) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.String {
+			value.Set(reflect.ValueOf(splitList(raw)))
+		}
+	}
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+)
+
+// Event notifikasi yang dikirim NotificationService
+const (
+	EventContractSigned  = "contract_signed"
+	EventInvoiceIssued   = "invoice_issued"
+	EventPaymentReceived = "payment_received"
+	EventPaymentReminder = "payment_reminder"
+	// EventProcessingFailed dikirim ke staf saat webhook gagal diproses, misalnya invoice gagal dibuat
+	EventProcessingFailed = "processing_failed"
+)
+
+// Peran penerima notifikasi
+const (
+	RoleStudent = "student"
+	RoleStaff   = "staff"
+)
+
+// Channel notifikasi
+const (
+	ChannelEmail    = "email"
+	ChannelWhatsApp = "whatsapp"
+)
+
+// NotificationRules memetakan event ke channel per peran penerima, contoh YAML:
+//
+//	notifications:
+//	  payment_received:
+//	    student: [email]
+//	    staff: [email, whatsapp]
+type NotificationRules map[string]map[string][]string
+
+// DefaultNotifications mengikuti perilaku sebelum channel bisa dikonfigurasi.
+// Event yang tidak ada di file konfigurasi memakai aturan di sini.
+var DefaultNotifications = NotificationRules{
+	EventContractSigned:   {RoleStaff: {ChannelEmail}},
+	EventInvoiceIssued:    {RoleStudent: {ChannelEmail}},
+	EventPaymentReceived:  {RoleStudent: {ChannelEmail}, RoleStaff: {ChannelEmail, ChannelWhatsApp}},
+	EventPaymentReminder:  {RoleStudent: {ChannelEmail}},
+	EventProcessingFailed: {RoleStaff: {ChannelEmail}},
+}
+
+// Channels mengembalikan channel yang aktif untuk event dan peran penerima
+func (r NotificationRules) Channels(event, role string) []string {
+	if roles, ok := r[event]; ok {
+		return roles[role]
+	}
+	return DefaultNotifications[event][role]
+}
+
+// applyNotificationDefaults melengkapi event yang tidak dikonfigurasi dengan aturan default
+func applyNotificationDefaults(cfg *Config) {
+	if cfg.Notifications == nil {
+		cfg.Notifications = NotificationRules{}
+	}
+	for event, roles := range DefaultNotifications {
+		if _, ok := cfg.Notifications[event]; !ok {
+			cfg.Notifications[event] = roles
+		}
+	}
+}
+
+func (r NotificationRules) validate() []string {
+	var errs []string
+	for event, roles := range r {
+		if _, ok := DefaultNotifications[event]; !ok {
+			errs = append(errs, fmt.Sprintf("notifications.%s is not a known event", event))
+		}
+		for role, channels := range roles {
+			if role != RoleStudent && role != RoleStaff {
+				errs = append(errs, fmt.Sprintf("notifications.%s.%s must be student or staff", event, role))
+			}
+			for _, ch := range channels {
+				if ch != ChannelEmail && ch != ChannelWhatsApp {
+					errs = append(errs, fmt.Sprintf("notifications.%s.%s contains unknown channel %q", event, role, ch))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// StaffRecipients adalah penerima email staf untuk satu event. Jika Digest bernilai true,
+// event dikumpulkan dan dikirim sekali sehari pada staff_digest_time (WIB), bukan satu email per event.
+type StaffRecipients struct {
+	Emails  []string `json:"emails" yaml:"emails" toml:"emails"`
+	Subject string   `json:"subject" yaml:"subject" toml:"subject"`
+	Digest  bool     `json:"digest" yaml:"digest" toml:"digest"`
+}
+
+// StaffNotifications memetakan event ke penerima staf, contoh YAML:
+//
+//	staff_notifications:
+//	  payment_received: {emails: [finance@go-global.id], digest: true}
+//	  processing_failed: {emails: [it@go-global.id]}
+type StaffNotifications map[string]StaffRecipients
+
+// StaffRecipients mengembalikan penerima staf untuk event: pengaturan tenant, lalu staff_notifications,
+// lalu STAFF_NOTIFICATION_EMAILS untuk deployment yang hanya memakai environment variable
+func (c *Config) StaffRecipients(t *Tenant, event string) StaffRecipients {
+	if t != nil {
+		if r, ok := t.StaffNotifications[event]; ok {
+			return r
+		}
+	}
+	if r, ok := c.StaffNotifications[event]; ok {
+		return r
+	}
+	return StaffRecipients{Emails: splitList(c.StaffNotificationEmails)}
+}
+
+// requiredStaffEvents adalah event yang wajib punya penerima staf selama channel email staf aktif,
+// tanpa penerima pembayaran dan kegagalan proses tidak diketahui siapa pun
+var requiredStaffEvents = []string{EventPaymentReceived, EventProcessingFailed}
+
+// validateStaffRecipients memastikan setiap tenant punya penerima untuk requiredStaffEvents
+func (c *Config) validateStaffRecipients() []string {
+	var errs []string
+	for _, event := range requiredStaffEvents {
+		if !containsString(c.Notifications.Channels(event, RoleStaff), ChannelEmail) {
+			continue
+		}
+		for i := range c.Tenants {
+			if len(c.StaffRecipients(&c.Tenants[i], event).Emails) == 0 {
+				errs = append(errs, fmt.Sprintf("tenant %s has no staff recipients for %s, set staff_notifications.%s or STAFF_NOTIFICATION_EMAILS",
+					c.Tenants[i].ID, event, event))
+			}
+		}
+	}
+	return errs
+}
+
+func (s StaffNotifications) validate(prefix string) []string {
+	var errs []string
+	for event, r := range s {
+		if _, ok := DefaultNotifications[event]; !ok {
+			errs = append(errs, fmt.Sprintf("%s.%s is not a known event", prefix, event))
+		}
+		for _, email := range r.Emails {
+			if _, err := mail.ParseAddress(email); err != nil {
+				errs = append(errs, fmt.Sprintf("%s.%s.emails contains invalid email %q", prefix, event, email))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,20 @@
+package config
+
+// ProgramConfig berisi komponen harga dan pengaturan invoice Xendit untuk satu program
+type ProgramConfig struct {
+	Name               string   `json:"name" yaml:"name" toml:"name"`
+	Tuition            float64  `json:"tuition" yaml:"tuition" toml:"tuition"`
+	DormitoryFee       float64  `json:"dormitory_fee" yaml:"dormitory_fee" toml:"dormitory_fee"`
+	AdminFee           float64  `json:"admin_fee" yaml:"admin_fee" toml:"admin_fee"`                                  // hanya ditagihkan pada pembayaran pertama
+	PaymentMethods     []string `json:"payment_methods" yaml:"payment_methods" toml:"payment_methods"`                // kosong = semua metode pembayaran yang aktif
+	SuccessRedirectURL string   `json:"success_redirect_url" yaml:"success_redirect_url" toml:"success_redirect_url"` // Optional
+	FailureRedirectURL string   `json:"failure_redirect_url" yaml:"failure_redirect_url" toml:"failure_redirect_url"` // Optional
+	Locale             string   `json:"locale" yaml:"locale" toml:"locale"`                                           // "id" atau "en"
+}
+
+// DefaultPrograms dipakai jika program tidak didefinisikan di file konfigurasi
+var DefaultPrograms = map[string]ProgramConfig{
+	"kelas_senin_jumat_siang": {Name: "Kelas Senin-Jumat Siang", Tuition: 6250000, Locale: "id"},
+	"kelas_senin_jumat_malam": {Name: "Kelas Senin-Jumat Malam", Tuition: 6000000, Locale: "id"},
+	"kelas_akhir_pekan":       {Name: "Kelas Akhir Pekan", Tuition: 6000000, Locale: "id"},
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Tenant adalah satu brand LPK yang dilayani oleh service ini
+type Tenant struct {
+	// ID dipakai di URL webhook (/webhook/:tenant) dan di external ID invoice, tidak boleh mengandung "-"
+	ID                         string   `json:"id" yaml:"id" toml:"id"`
+	Name                       string   `json:"name" yaml:"name" toml:"name"`
+	XenditSecretKey            string   `json:"xendit_secret_key" yaml:"xendit_secret_key" toml:"xendit_secret_key" log:"secret"`
+	XenditCallbackToken        string   `json:"xendit_callback_token" yaml:"xendit_callback_token" toml:"xendit_callback_token" log:"secret"`
+	MekariClientID             string   `json:"mekari_client_id" yaml:"mekari_client_id" toml:"mekari_client_id"`
+	MekariClientSecret         string   `json:"mekari_client_secret" yaml:"mekari_client_secret" toml:"mekari_client_secret" log:"secret"`
+	DirectorEmails             []string `json:"director_emails" yaml:"director_emails" toml:"director_emails"`
+	TemplateDir                string   `json:"template_dir" yaml:"template_dir" toml:"template_dir"`
+	WhatsappSender             string   `json:"whatsapp_sender" yaml:"whatsapp_sender" toml:"whatsapp_sender"`
+	WhatsappTemplateID         string   `json:"whatsapp_template_id" yaml:"whatsapp_template_id" toml:"whatsapp_template_id"`
+	WhatsappNotificationNumber string   `json:"whatsapp_notification_number" yaml:"whatsapp_notification_number" toml:"whatsapp_notification_number"`
+	// StaffNotifications menggantikan staff_notifications global untuk event yang ditulis di sini
+	StaffNotifications StaffNotifications `json:"staff_notifications" yaml:"staff_notifications" toml:"staff_notifications"`
+}
+
+// IsDirector bernilai true jika email adalah salah satu direktur penandatangan dokumen tenant
+func (t *Tenant) IsDirector(email string) bool {
+	for _, d := range t.DirectorEmails {
+		if strings.EqualFold(d, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// TemplatePath mengembalikan path file template email milik tenant
+func (t *Tenant) TemplatePath(name string) string {
+	dir := t.TemplateDir
+	if dir == "" {
+		dir = "templates"
+	}
+	return filepath.Join(dir, name)
+}
+
+// Tenant mencari tenant berdasarkan ID, mengembalikan nil jika tidak ada
+func (c *Config) Tenant(id string) *Tenant {
+	for i := range c.Tenants {
+		if c.Tenants[i].ID == id {
+			return &c.Tenants[i]
+		}
+	}
+	return nil
+}
+
+// DefaultTenant adalah tenant pertama, dipakai untuk webhook yang tidak menyebutkan tenant
+func (c *Config) DefaultTenant() *Tenant {
+	if len(c.Tenants) == 0 {
+		return nil
+	}
+	return &c.Tenants[0]
+}
+
+// legacyTenant membuat satu tenant dari environment variable lama agar deployment yang sudah ada tetap berjalan
+func legacyTenant(cfg *Config) Tenant {
+	return Tenant{
+		ID:                         "goglobal",
+		Name:                       "Go Global Indonesia",
+		XenditSecretKey:            cfg.XenditSecretKey,
+		XenditCallbackToken:        cfg.XenditCallbackToken,
+		DirectorEmails:             splitList(cfg.DirectorMail),
+		TemplateDir:                "templates",
+		WhatsappSender:             "WKWK JAPANESE",
+		WhatsappTemplateID:         "194cd576-8d34-4f5f-b9ca-29e97d1bbe90",
+		WhatsappNotificationNumber: cfg.WhatsappNotificationNumber,
+	}
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Batas retry pesan RabbitMQ: jeda retry digandakan tiap percobaan sampai RabbitMqRetryDelayCap
+const (
+	RabbitMqRetryLimit    = 20
+	RabbitMqRetryDelayCap = time.Hour
+)
+
+// tenantIDPattern memakai kelas karakter yang sama dengan segmen tenant pada external ID "q1-<tenant>-<data_id>",
+// sehingga tenant ID selalu bisa dibaca kembali dari external ID invoice
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ValidationErrors berisi semua kesalahan konfigurasi yang ditemukan saat startup
+type ValidationErrors []string
+
+func (v ValidationErrors) Error() string {
+	lines := make([]string, len(v))
+	for i, e := range v {
+		lines[i] = "  - " + e
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate memeriksa aturan pada tag validate serta konfigurasi program dan tenant
+func (c *Config) Validate() ValidationErrors {
+	var errs ValidationErrors
+
+	forEachField(c, func(field reflect.StructField, value reflect.Value) {
+		rules := field.Tag.Get("validate")
+		if rules == "" || value.Kind() != reflect.String {
+			return
+		}
+		name := field.Tag.Get("env")
+		if name == "" {
+			name = field.Tag.Get("yaml")
+		}
+		if msg := checkRules(value.String(), strings.Split(rules, ",")); msg != "" {
+			errs = append(errs, fmt.Sprintf("%s %s", name, msg))
+		}
+	})
+
+	if c.TracingExporter == "otlp" && c.TracingEndpoint == "" {
+		errs = append(errs, "OTEL_EXPORTER_OTLP_ENDPOINT is required when OTEL_TRACES_EXPORTER is otlp")
+	}
+
+	if len(c.RabbitMqBindingKeys) == 0 {
+		errs = append(errs, "RABBITMQ_BINDING_KEYS must contain at least one routing key pattern, otherwise published emails are dropped")
+	}
+
+	if n, err := strconv.Atoi(c.RabbitMqMaxRetries); err == nil && n > RabbitMqRetryLimit {
+		errs = append(errs, fmt.Sprintf("RABBITMQ_MAX_RETRIES must be at most %d, got %d", RabbitMqRetryLimit, n))
+	}
+	if d, err := time.ParseDuration(c.RabbitMqRetryDelay); err == nil && d > RabbitMqRetryDelayCap {
+		errs = append(errs, fmt.Sprintf("RABBITMQ_RETRY_DELAY must be at most %s, got %s", RabbitMqRetryDelayCap, d))
+	}
+
+	for i, prefix := range c.AttachmentURLPrefixes {
+		if msg := checkRules(prefix, []string{"url"}); msg != "" {
+			errs = append(errs, fmt.Sprintf("ATTACHMENT_URL_PREFIXES[%d] %s", i, msg))
+		}
+	}
+
+	names := map[string]bool{}
+	for i, entry := range c.AdminAPIKeys {
+		name, key, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || key == "" {
+			errs = append(errs, fmt.Sprintf("ADMIN_API_KEYS[%d] must be in name:key format", i))
+		} else if names[name] {
+			errs = append(errs, fmt.Sprintf("ADMIN_API_KEYS name %q is duplicated", name))
+		}
+		names[name] = true
+	}
+
+	errs = append(errs, c.Notifications.validate()...)
+	errs = append(errs, c.StaffNotifications.validate("staff_notifications")...)
+	errs = append(errs, c.validateStaffRecipients()...)
+
+	for key, p := range c.Programs {
+		if p.Tuition <= 0 {
+			errs = append(errs, fmt.Sprintf("programs.%s.tuition must be greater than zero", key))
+		}
+		if p.DormitoryFee < 0 || p.AdminFee < 0 {
+			errs = append(errs, fmt.Sprintf("programs.%s fees must not be negative", key))
+		}
+		if msg := checkRules(p.SuccessRedirectURL, []string{"url"}); msg != "" {
+			errs = append(errs, fmt.Sprintf("programs.%s.success_redirect_url %s", key, msg))
+		}
+		if msg := checkRules(p.FailureRedirectURL, []string{"url"}); msg != "" {
+			errs = append(errs, fmt.Sprintf("programs.%s.failure_redirect_url %s", key, msg))
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, t := range c.Tenants {
+		prefix := fmt.Sprintf("tenants[%d]", i)
+		if t.ID == "" {
+			errs = append(errs, prefix+".id is required")
+		} else if !tenantIDPattern.MatchString(t.ID) {
+			errs = append(errs, fmt.Sprintf("%s.id %q must only contain letters, digits and '_'", prefix, t.ID))
+		} else if seen[t.ID] {
+			errs = append(errs, fmt.Sprintf("%s.id %q is duplicated", prefix, t.ID))
+		}
+		seen[t.ID] = true
+
+		if t.Name == "" {
+			errs = append(errs, prefix+".name is required")
+		}
+		if t.XenditSecretKey == "" {
+			errs = append(errs, prefix+".xendit_secret_key is required (XENDIT_SECRET_KEY)")
+		}
+		if t.XenditCallbackToken == "" {
+			errs = append(errs, prefix+".xendit_callback_token is required (XENDIT_CALLBACK_TOKEN)")
+		}
+		for _, email := range t.DirectorEmails {
+			if _, err := mail.ParseAddress(email); err != nil {
+				errs = append(errs, fmt.Sprintf("%s.director_emails contains invalid email %q", prefix, email))
+			}
+		}
+		if msg := checkRules(t.WhatsappNotificationNumber, []string{"phone"}); msg != "" {
+			errs = append(errs, fmt.Sprintf("%s.whatsapp_notification_number %s", prefix, msg))
+		}
+		errs = append(errs, t.StaffNotifications.validate(prefix+".staff_notifications")...)
+	}
+
+	return errs
+}
+
+// CheckValue memeriksa nilai yang diubah di luar file konfigurasi, misalnya settings dari API admin,
+// dengan aturan yang sama seperti tag validate
+func CheckValue(value string, rules ...string) string {
+	return checkRules(value, rules)
+}
+
+// checkRules mengembalikan pesan kesalahan pertama, atau string kosong jika valid.
+// Aturan selain required hanya diperiksa jika nilai tidak kosong.
+func checkRules(value string, rules []string) string {
+	for _, rule := range rules {
+		if value == "" {
+			if rule == "required" {
+				return "is required"
+			}
+			continue
+		}
+
+		if options, ok := strings.CutPrefix(rule, "oneof="); ok {
+			if !containsString(strings.Split(options, "|"), value) {
+				return fmt.Sprintf("must be one of %s, got %q", strings.ReplaceAll(options, "|", ", "), value)
+			}
+			continue
+		}
+
+		switch rule {
+		case "number":
+			if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+				return fmt.Sprintf("must be a number, got %q", value)
+			}
+		case "phone":
+			digits := strings.TrimPrefix(value, "+")
+			if _, err := strconv.ParseUint(digits, 10, 64); err != nil || len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+				return fmt.Sprintf("must be a phone number in international format like +628123456789, got %q", value)
+			}
+		case "port":
+			if p, err := strconv.Atoi(value); err != nil || p < 1 || p > 65535 {
+				return fmt.Sprintf("must be a port number between 1 and 65535, got %q", value)
+			}
+		case "url":
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Sprintf("must be an absolute URL, got %q", value)
+			}
+		case "duration":
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return fmt.Sprintf("must be a positive duration like 30s or 5m, got %q", value)
+			}
+		case "clock":
+			if _, err := time.Parse("15:04", value); err != nil {
+				return fmt.Sprintf("must be a time of day like 08:00, got %q", value)
+			}
+		case "emails":
+			for _, email := range splitList(value) {
+				if _, err := mail.ParseAddress(email); err != nil {
+					return fmt.Sprintf("contains invalid email %q", email)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
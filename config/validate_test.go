@@ -0,0 +1,91 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRules(t *testing.T) {
+	tests := []struct {
+		value   string
+		rules   string
+		wantErr bool
+	}{
+		{"", "required", true},
+		{"", "port", false},
+		{"3000", "required,port", false},
+		{"70000", "port", true},
+		{"432000", "number", false},
+		{"-1", "number", true},
+		{"https://webhook.go-global.id", "url", false},
+		{"webhook.go-global.id", "url", true},
+		{"a@example.com, b@example.com", "emails", false},
+		{"a@example.com, bukan-email", "emails", true},
+		{"30s", "duration", false},
+		{"0s", "duration", true},
+		{"08:00", "clock", false},
+		{"8 pagi", "clock", true},
+		{"json", "oneof=json|console", false},
+		{"xml", "oneof=json|console", true},
+		{"+6281234567890", "phone", false},
+		{"6281234567890", "phone", false},
+		{"081234567890", "phone", true},
+		{"+62 812 3456", "phone", true},
+		{"+62812", "phone", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rules+"/"+tt.value, func(t *testing.T) {
+			msg := checkRules(tt.value, strings.Split(tt.rules, ","))
+			if (msg != "") != tt.wantErr {
+				t.Errorf("checkRules(%q, %q) = %q, wantErr %v", tt.value, tt.rules, msg, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+		want   string // potongan pesan yang diharapkan, kosong jika valid
+	}{
+		{"example config", func(*Config) {}, ""},
+		{"missing database url", func(c *Config) { c.DatabaseURL = "" }, "DATABASE_URL is required"},
+		{"tenant id with dash", func(c *Config) { c.Tenants[0].ID = "go-global" }, `tenants[0].id "go-global" must only contain letters, digits and '_'`},
+		{"tenant id with dot", func(c *Config) { c.Tenants[0].ID = "go.global" }, `tenants[0].id "go.global" must only contain`},
+		{"duplicated tenant", func(c *Config) { c.Tenants = append(c.Tenants, c.Tenants[0]) }, `tenants[1].id "goglobal" is duplicated`},
+		{"invalid director email", func(c *Config) { c.Tenants[0].DirectorEmails = []string{"direktur"} }, `director_emails contains invalid email "direktur"`},
+		{"invalid metrics port", func(c *Config) { c.MetricsPort = "0" }, "METRICS_PORT must be a port number"},
+		{"relative attachment prefix", func(c *Config) { c.AttachmentURLPrefixes = []string{"/files"} }, "ATTACHMENT_URL_PREFIXES[0]"},
+		{"too many retries", func(c *Config) { c.RabbitMqMaxRetries = "64" }, "RABBITMQ_MAX_RETRIES must be at most 20"},
+		{"retry delay above cap", func(c *Config) { c.RabbitMqRetryDelay = "2h" }, "RABBITMQ_RETRY_DELAY must be at most 1h0m0s"},
+		{"otlp without endpoint", func(c *Config) { c.TracingExporter, c.TracingEndpoint = "otlp", "" }, "OTEL_EXPORTER_OTLP_ENDPOINT is required"},
+		{"no binding keys", func(c *Config) { c.RabbitMqBindingKeys = nil }, "RABBITMQ_BINDING_KEYS"},
+		{"local whatsapp number", func(c *Config) { c.WhatsappNotificationNumber = "081234567890" }, "WHATSAPP_NOTIFICATION_NUMBER must be a phone number"},
+		{"local tenant whatsapp number", func(c *Config) { c.Tenants[0].WhatsappNotificationNumber = "081234567890" }, "tenants[0].whatsapp_notification_number must be a phone number"},
+		{"admin key without name", func(c *Config) { c.AdminAPIKeys = []string{"secret"} }, "ADMIN_API_KEYS[0] must be in name:key format"},
+		{"duplicated admin name", func(c *Config) { c.AdminAPIKeys = []string{"budi:k1", "budi:k2"} }, `ADMIN_API_KEYS name "budi" is duplicated`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load("../config.example.yaml")
+			if err != nil {
+				t.Fatalf("example config is invalid:\n%v", err)
+			}
+			tt.mutate(cfg)
+
+			errs := cfg.Validate()
+			if tt.want == "" {
+				if len(errs) > 0 {
+					t.Errorf("Validate() =\n%v", errs)
+				}
+				return
+			}
+			if !strings.Contains(errs.Error(), tt.want) {
+				t.Errorf("Validate() =\n%v\nwant error containing %q", errs, tt.want)
+			}
+		})
+	}
+}
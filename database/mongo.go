@@ -7,9 +7,12 @@ import (
 	"time"
 
 	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/metrics"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 type Database struct {
@@ -18,7 +21,7 @@ type Database struct {
 }
 
 func ConnectMongoDB(cfg *config.Config) (*Database, error) {
-	clientOptions := options.Client().ApplyURI(cfg.DatabaseURL)
+	clientOptions := options.Client().ApplyURI(cfg.DatabaseURL).SetMonitor(commandMonitor())
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -35,3 +38,20 @@ func ConnectMongoDB(cfg *config.Config) (*Database, error) {
 
 	return &Database{Client: client, DB: client.Database(cfg.DatabaseName)}, nil
 }
+
+// commandMonitor mencatat lama setiap perintah MongoDB ke metrics external_call_duration_seconds
+// dan membuat span OpenTelemetry untuk setiap perintah
+func commandMonitor() *event.CommandMonitor {
+	otelMonitor := otelmongo.NewMonitor()
+	return &event.CommandMonitor{
+		Started: otelMonitor.Started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			metrics.Observe(metrics.Mongo, e.CommandName, "success", e.Duration)
+			otelMonitor.Succeeded(ctx, e)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			metrics.Observe(metrics.Mongo, e.CommandName, "error", e.Duration)
+			otelMonitor.Failed(ctx, e)
+		},
+	}
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	invoice "github.com/xendit/xendit-go/v6/invoice"
+	"go.uber.org/zap"
+)
+
+// invoiceGateway adalah bagian XenditService yang dipakai endpoint admin invoice
+type invoiceGateway interface {
+	GetInvoice(ctx context.Context, invoiceID string) (*invoice.Invoice, error)
+	ExpireInvoice(ctx context.Context, invoiceID string) (*invoice.Invoice, error)
+	CreateInvoice(ctx context.Context, externalID, payerEmail string, description string, customerData *service.CustomerObject, invDuration string, amount float64, forUserID string, opts *service.InvoiceOptions) (*invoice.Invoice, error)
+}
+
+// invoiceLedger adalah bagian LedgerService yang dipakai endpoint admin invoice
+type invoiceLedger interface {
+	FindByExternalID(ctx context.Context, externalID string) (*service.LedgerEntry, error)
+	Chain(ctx context.Context, documentID string, paymentFor int) ([]service.LedgerEntry, error)
+	RecordInvoice(ctx context.Context, entry service.LedgerEntry) error
+	MarkStatus(ctx context.Context, externalID string, status string) error
+	MarkReplaced(ctx context.Context, externalID string, replacedBy string, reason string) error
+}
+
+// settingsReader mengambil pengaturan efektif tenant, dipenuhi oleh SettingsService
+type settingsReader interface {
+	Get(t *config.Tenant) service.Settings
+}
+
+type AdminInvoiceHandler struct {
+	xendit   map[string]invoiceGateway
+	ledger   invoiceLedger
+	settings settingsReader
+	cfg      *config.Config
+}
+
+func NewAdminInvoiceHandler(xendit map[string]*service.XenditService, ledger *service.LedgerService, settings *service.SettingsService, cfg *config.Config) *AdminInvoiceHandler {
+	gateways := make(map[string]invoiceGateway, len(xendit))
+	for id, xs := range xendit {
+		gateways[id] = xs
+	}
+	return &AdminInvoiceHandler{xendit: gateways, ledger: ledger, settings: settings, cfg: cfg}
+}
+
+// GetInvoiceChain menampilkan entry ledger beserta seluruh rantai penggantiannya
+func (h *AdminInvoiceHandler) GetInvoiceChain(c echo.Context) error {
+	ctx := requestContext(c)
+
+	entry, err := h.ledger.FindByExternalID(ctx, c.Param("external_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read ledger"})
+	}
+	if entry == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Invoice not found in ledger"})
+	}
+
+	chain, err := h.ledger.Chain(ctx, entry.DocumentID, entry.PaymentFor)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read ledger"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"invoice": entry,
+		"chain":   chain,
+	})
+}
+
+// ExpireInvoice membatalkan invoice yang belum dibayar tanpa membuat invoice pengganti
+func (h *AdminInvoiceHandler) ExpireInvoice(c echo.Context) error {
+	type Request struct {
+		Reason string `json:"reason"`
+	}
+
+	req := new(Request)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	ctx := requestContext(c)
+	entry, errResp := h.findActiveEntry(ctx, c.Param("external_id"))
+	if errResp != nil {
+		return c.JSON(errResp.status, map[string]string{"error": errResp.message})
+	}
+
+	expired, err := h.xenditFor(entry).ExpireInvoice(ctx, entry.InvoiceID)
+	if err != nil {
+		requestLogger(c).Error("Failed to expire invoice", zap.String("external_id", entry.ExternalID), zap.Error(err))
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to expire invoice"})
+	}
+
+	if err := h.ledger.MarkStatus(ctx, entry.ExternalID, string(expired.Status)); err != nil {
+		requestLogger(c).Error("Failed to update ledger status", zap.Error(err))
+	}
+
+	requestLogger(c).Info("Invoice expired by admin",
+		zap.String("external_id", entry.ExternalID), zap.String("reason", req.Reason))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":     "Invoice expired",
+		"external_id": entry.ExternalID,
+		"status":      expired.Status,
+	})
+}
+
+// ReplaceInvoice membatalkan invoice lama lalu membuat invoice pengganti dengan versi external ID berikutnya.
+// Deskripsi selalu memakai format standar agar callback pembayaran tetap dikenali; note hanya ditambahkan di akhir.
+// Rincian harga invoice lama ikut dibawa, selisih nominal baru dicatat sebagai penyesuaian.
+func (h *AdminInvoiceHandler) ReplaceInvoice(c echo.Context) error {
+	type Request struct {
+		Amount      float64 `json:"amount"` // Optional, default sama dengan invoice lama
+		Note        string  `json:"note"`   // Optional, ditambahkan di akhir deskripsi
+		Description string  `json:"description"`
+		Reason      string  `json:"reason"`
+	}
+
+	req := new(Request)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Description != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Description cannot be changed, use note to append text"})
+	}
+	if req.Amount < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Amount must be greater than zero"})
+	}
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Reason is required"})
+	}
+
+	ctx := requestContext(c)
+	entry, errResp := h.findActiveEntry(ctx, c.Param("external_id"))
+	if errResp != nil {
+		return c.JSON(errResp.status, map[string]string{"error": errResp.message})
+	}
+
+	parts, ok := parseExternalID(entry.ExternalID)
+	if !ok {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "External ID was not created by this service"})
+	}
+	xs := h.xenditFor(entry)
+
+	old, err := xs.GetInvoice(ctx, entry.InvoiceID)
+	if err != nil {
+		requestLogger(c).Error("Failed to get invoice", zap.String("external_id", entry.ExternalID), zap.Error(err))
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to get invoice"})
+	}
+	if isPaidStatus(string(old.Status)) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Invoice is already paid"})
+	}
+
+	amount := req.Amount
+	if amount == 0 {
+		amount = entry.Amount
+	}
+	if amount <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Amount must be greater than zero"})
+	}
+
+	// invoice lama dibatalkan lebih dulu agar siswa tidak bisa membayar dua invoice sekaligus.
+	// Status EXPIRED langsung dicatat di ledger sehingga jika invoice pengganti gagal dibuat,
+	// ledger tetap sesuai Xendit dan admin bisa mengulang penggantian.
+	if old.Status == invoice.INVOICESTATUS_PENDING {
+		expired, err := xs.ExpireInvoice(ctx, entry.InvoiceID)
+		if err != nil {
+			requestLogger(c).Error("Failed to expire invoice", zap.String("external_id", entry.ExternalID), zap.Error(err))
+			return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to expire invoice"})
+		}
+		if err := h.ledger.MarkStatus(ctx, entry.ExternalID, string(expired.Status)); err != nil {
+			requestLogger(c).Error("Failed to update ledger status", zap.String("external_id", entry.ExternalID), zap.Error(err))
+		}
+	}
+
+	payerName := entry.PayerName
+	if payerName == "" && old.Description != nil {
+		payerName = payerNameFromDescription(*old.Description)
+	}
+	description := invoiceDescription(parts.PaymentFor, h.tenantFor(entry), payerName, req.Note)
+	opts := h.replacementOptions(entry, amount, req.Reason)
+
+	// invoice pengganti berlaku sampai tanggal kedaluwarsa invoice lama, atau durasi default jika sudah lewat
+	invDuration := h.settings.Get(h.tenantFor(entry)).InvoiceDuration
+	if remaining := time.Until(old.ExpiryDate); remaining > 0 {
+		invDuration = fmt.Sprintf("%.0f", remaining.Seconds())
+	}
+
+	newExternalID := buildExternalID(parts.TenantID, parts.PaymentFor, parts.DataID, parts.Version+1)
+	customer := service.CustomerFromInvoice(old)
+	customer.Id = newExternalID
+	customer.CustomerId = newExternalID
+
+	payerEmail := entry.PayerEmail
+	if old.PayerEmail != nil {
+		payerEmail = *old.PayerEmail
+	}
+
+	replacement, err := xs.CreateInvoice(ctx, newExternalID, payerEmail, description, customer, invDuration, amount, "", opts)
+	if err != nil {
+		requestLogger(c).Error("Failed to create replacement invoice, the old invoice is expired without a replacement",
+			zap.String("external_id", entry.ExternalID), zap.String("new_external_id", newExternalID), zap.Error(err))
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error":       "Failed to create replacement invoice, the old invoice has been expired; retry the replacement",
+			"external_id": entry.ExternalID,
+		})
+	}
+
+	replacementID := ""
+	if replacement.Id != nil {
+		replacementID = *replacement.Id
+	}
+
+	// invoice lama ditandai diganti walaupun pencatatan invoice baru gagal, agar callback invoice lama diabaikan
+	recordErr := h.ledger.RecordInvoice(ctx, service.LedgerEntry{
+		TenantID:     entry.TenantID,
+		ExternalID:   newExternalID,
+		InvoiceID:    replacementID,
+		DocumentID:   parts.DataID,
+		PaymentFor:   parts.PaymentFor,
+		Version:      parts.Version + 1,
+		PayerEmail:   payerEmail,
+		PayerName:    payerName,
+		Description:  description,
+		InvoiceURL:   replacement.InvoiceUrl,
+		Amount:       amount,
+		Pricing:      replacementQuote(entry.Pricing, amount, req.Reason),
+		Status:       string(replacement.Status),
+		Replaces:     entry.ExternalID,
+		ChangeReason: req.Reason,
+	})
+	if recordErr != nil {
+		requestLogger(c).Error("Failed to record replacement invoice in ledger",
+			zap.String("new_external_id", newExternalID), zap.Error(recordErr))
+	}
+	markErr := h.ledger.MarkReplaced(ctx, entry.ExternalID, newExternalID, req.Reason)
+	if markErr != nil {
+		requestLogger(c).Error("Failed to mark invoice as replaced",
+			zap.String("external_id", entry.ExternalID), zap.Error(markErr))
+	}
+	if recordErr != nil || markErr != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":        "Replacement invoice was created but the ledger could not be updated",
+			"replaces":     entry.ExternalID,
+			"external_id":  newExternalID,
+			"invoice_id":   replacementID,
+			"invoice_link": replacement.InvoiceUrl,
+		})
+	}
+
+	requestLogger(c).Info("Invoice replaced by admin",
+		zap.String("old_external_id", entry.ExternalID),
+		zap.String("new_external_id", newExternalID),
+		zap.Float64("amount", amount),
+		zap.String("reason", req.Reason))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":      "Invoice replaced",
+		"replaces":     entry.ExternalID,
+		"external_id":  newExternalID,
+		"invoice_id":   replacementID,
+		"invoice_link": replacement.InvoiceUrl,
+		"amount":       amount,
+	})
+}
+
+// replacementOptions membawa rincian harga invoice lama (item, biaya admin, potongan) ke invoice pengganti.
+// Invoice lama tanpa rincian (dibuat sebelum pricing tercatat) diganti tanpa rincian.
+func (h *AdminInvoiceHandler) replacementOptions(entry *service.LedgerEntry, amount float64, reason string) *service.InvoiceOptions {
+	quote := replacementQuote(entry.Pricing, amount, reason)
+	if quote == nil {
+		return nil
+	}
+	return quoteInvoiceOptions(quote, h.cfg.Programs[quote.ProgramType])
+}
+
+// replacementQuote menyalin quote invoice lama; jika nominal berubah, selisihnya dicatat sebagai penyesuaian
+// dengan alasan penggantian sehingga total rincian tetap sama dengan nominal invoice
+func replacementQuote(quote *service.PriceQuote, amount float64, reason string) *service.PriceQuote {
+	if quote == nil {
+		return nil
+	}
+	q := *quote
+	q.Adjustments = append([]service.PriceAdjustment(nil), quote.Adjustments...)
+	if diff := amount - quote.Total; diff != 0 {
+		q.Adjustments = append(q.Adjustments, service.PriceAdjustment{
+			Rule:        "manual",
+			Description: "Penyesuaian: " + reason,
+			Amount:      diff,
+		})
+		q.Total = amount
+	}
+	return &q
+}
+
+// xenditFor mengambil XenditService milik tenant yang membuat invoice
+func (h *AdminInvoiceHandler) xenditFor(entry *service.LedgerEntry) invoiceGateway {
+	return h.xendit[h.tenantFor(entry).ID]
+}
+
+// tenantFor mengambil tenant yang membuat invoice, atau tenant default untuk entry lama
+func (h *AdminInvoiceHandler) tenantFor(entry *service.LedgerEntry) *config.Tenant {
+	if t := h.cfg.Tenant(entry.TenantID); t != nil {
+		return t
+	}
+	return h.cfg.DefaultTenant()
+}
+
+type adminError struct {
+	status  int
+	message string
+}
+
+// findActiveEntry mengambil entry ledger yang masih bisa dibatalkan atau diganti
+func (h *AdminInvoiceHandler) findActiveEntry(ctx context.Context, externalID string) (*service.LedgerEntry, *adminError) {
+	entry, err := h.ledger.FindByExternalID(ctx, externalID)
+	if err != nil {
+		return nil, &adminError{http.StatusInternalServerError, "Failed to read ledger"}
+	}
+	if entry == nil {
+		return nil, &adminError{http.StatusNotFound, "Invoice not found in ledger"}
+	}
+	if entry.ReplacedBy != "" {
+		return nil, &adminError{http.StatusConflict, fmt.Sprintf("Invoice already replaced by %s", entry.ReplacedBy)}
+	}
+	if isPaidStatus(entry.Status) {
+		return nil, &adminError{http.StatusConflict, "Invoice is already paid"}
+	}
+	if entry.InvoiceID == "" {
+		return nil, &adminError{http.StatusUnprocessableEntity, "Ledger entry has no Xendit invoice ID"}
+	}
+	return entry, nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"webhook-listener-mekarisign/service"
+
+	invoice "github.com/xendit/xendit-go/v6/invoice"
+)
+
+func TestReplaceInvoice(t *testing.T) {
+	const oldID = "q1-goglobal-doc1"
+	const newID = "q1-goglobal-doc1-v2"
+
+	tests := []struct {
+		name          string
+		body          string
+		xenditStatus  invoice.InvoiceStatus
+		ledgerAmount  float64
+		createErr     error
+		recordErr     error
+		markErr       error
+		wantCode      int
+		wantCalls     string
+		wantOldStatus string
+		wantNewEntry  bool
+	}{
+		{
+			name: "replaces pending invoice", body: `{"reason":"salah nominal","amount":5000000}`,
+			xenditStatus: invoice.INVOICESTATUS_PENDING, ledgerAmount: 6000000,
+			wantCode: http.StatusOK, wantCalls: "get,expire,create", wantOldStatus: service.LedgerStatusReplaced, wantNewEntry: true,
+		},
+		{
+			name: "already expired invoice is not expired again", body: `{"reason":"perpanjang"}`,
+			xenditStatus: invoice.INVOICESTATUS_EXPIRED, ledgerAmount: 6000000,
+			wantCode: http.StatusOK, wantCalls: "get,create", wantOldStatus: service.LedgerStatusReplaced, wantNewEntry: true,
+		},
+		{
+			name: "paid invoice", body: `{"reason":"salah nominal"}`,
+			xenditStatus: invoice.INVOICESTATUS_PAID, ledgerAmount: 6000000,
+			wantCode: http.StatusConflict, wantCalls: "get", wantOldStatus: "PENDING",
+		},
+		{
+			name: "invalid amount is rejected before expiring", body: `{"reason":"salah nominal"}`,
+			xenditStatus: invoice.INVOICESTATUS_PENDING, ledgerAmount: 0,
+			wantCode: http.StatusBadRequest, wantCalls: "get", wantOldStatus: "PENDING",
+		},
+		{
+			name: "create failure leaves old invoice recorded as expired", body: `{"reason":"salah nominal"}`,
+			xenditStatus: invoice.INVOICESTATUS_PENDING, ledgerAmount: 6000000, createErr: errFake,
+			wantCode: http.StatusBadGateway, wantCalls: "get,expire,create", wantOldStatus: "EXPIRED",
+		},
+		{
+			name: "ledger record failure still marks old invoice replaced", body: `{"reason":"salah nominal"}`,
+			xenditStatus: invoice.INVOICESTATUS_PENDING, ledgerAmount: 6000000, recordErr: errFake,
+			wantCode: http.StatusInternalServerError, wantCalls: "get,expire,create", wantOldStatus: service.LedgerStatusReplaced,
+		},
+		{
+			name: "mark replaced failure fails the request", body: `{"reason":"salah nominal"}`,
+			xenditStatus: invoice.INVOICESTATUS_PENDING, ledgerAmount: 6000000, markErr: errFake,
+			wantCode: http.StatusInternalServerError, wantCalls: "get,expire,create", wantOldStatus: "EXPIRED", wantNewEntry: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newFakeLedger(service.LedgerEntry{
+				TenantID: "goglobal", ExternalID: oldID, InvoiceID: "inv-1", DocumentID: "doc1", PaymentFor: 1, Version: 1,
+				PayerEmail: "budi@example.com", PayerName: "Budi", Amount: tt.ledgerAmount, Status: "PENDING",
+			})
+			ledger.recordErr, ledger.markReplaceErr = tt.recordErr, tt.markErr
+			desc := "Pembayaran ke-1 Go Global kepada Budi"
+			gateway := &fakeGateway{createErr: tt.createErr, invoice: invoice.Invoice{
+				ExternalId: oldID, Status: tt.xenditStatus, Description: &desc, ExpiryDate: time.Now().Add(48 * time.Hour),
+			}}
+			h := &AdminInvoiceHandler{
+				xendit:   map[string]invoiceGateway{"goglobal": gateway},
+				ledger:   ledger,
+				settings: fakeSettings{InvoiceDuration: "432000"},
+				cfg:      testConfig,
+			}
+
+			code, resp := callHandler(t, http.MethodPost, "/invoices/:external_id/replace", "/invoices/"+oldID+"/replace", h.ReplaceInvoice, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%v)", code, tt.wantCode, resp)
+			}
+			if got := strings.Join(gateway.calls, ","); got != tt.wantCalls {
+				t.Errorf("xendit calls = %s, want %s", got, tt.wantCalls)
+			}
+			if got := ledger.entries[oldID].Status; got != tt.wantOldStatus {
+				t.Errorf("old ledger status = %s, want %s", got, tt.wantOldStatus)
+			}
+			newEntry, recorded := ledger.entries[newID]
+			if recorded != tt.wantNewEntry {
+				t.Fatalf("replacement recorded = %v, want %v", recorded, tt.wantNewEntry)
+			}
+			if recorded && (newEntry.Replaces != oldID || newEntry.Version != 2 || !strings.HasPrefix(newEntry.Description, desc)) {
+				t.Errorf("replacement entry = %+v", newEntry)
+			}
+			if code >= 500 && tt.createErr == nil && resp["external_id"] != newID {
+				t.Errorf("error response should name the replacement, got %v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type AdminNotificationHandler struct {
+	notifications *service.NotificationService
+}
+
+func NewAdminNotificationHandler(notifications *service.NotificationService) *AdminNotificationHandler {
+	return &AdminNotificationHandler{notifications: notifications}
+}
+
+// GetDeliveries menampilkan status setiap channel untuk satu kejadian, key adalah external ID invoice
+func (h *AdminNotificationHandler) GetDeliveries(c echo.Context) error {
+	key := c.Param("key")
+	deliveries, err := h.notifications.Deliveries(requestContext(c), key)
+	if err != nil {
+		requestLogger(c).Error("Failed to read notification deliveries", zap.String("key", key), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read notification deliveries"})
+	}
+	if len(deliveries) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No notifications for this key"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"key":        key,
+		"deliveries": deliveries,
+	})
+}
+
+// GetPreference menampilkan channel yang dinonaktifkan penerima (email atau nomor telepon)
+func (h *AdminNotificationHandler) GetPreference(c echo.Context) error {
+	recipient := strings.ToLower(c.Param("recipient"))
+	pref, err := h.notifications.Preference(requestContext(c), recipient)
+	if err != nil {
+		requestLogger(c).Error("Failed to read notification preference", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read notification preference"})
+	}
+	if pref == nil {
+		pref = &service.NotificationPreference{Recipient: recipient, DisabledChannels: []string{}}
+	}
+	return c.JSON(http.StatusOK, pref)
+}
+
+// UpdatePreference mengganti daftar channel yang dinonaktifkan penerima
+func (h *AdminNotificationHandler) UpdatePreference(c echo.Context) error {
+	actor := adminActor(c)
+	if actor == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": personalKeyRequired})
+	}
+
+	var req struct {
+		DisabledChannels []string `json:"disabled_channels"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	pref, err := h.notifications.SetPreference(requestContext(c), c.Param("recipient"), req.DisabledChannels, actor)
+	if err != nil {
+		requestLogger(c).Error("Failed to update notification preference", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	requestLogger(c).Info("Notification preference updated", zap.String("changed_by", actor))
+	return c.JSON(http.StatusOK, pref)
+}
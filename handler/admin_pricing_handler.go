@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/model"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+type AdminPricingHandler struct {
+	pricing *service.PricingService
+	cfg     *config.Config
+}
+
+func NewAdminPricingHandler(pricing *service.PricingService, cfg *config.Config) *AdminPricingHandler {
+	return &AdminPricingHandler{pricing: pricing, cfg: cfg}
+}
+
+// ListRules menampilkan semua aturan harga termasuk yang tidak aktif
+func (h *AdminPricingHandler) ListRules(c echo.Context) error {
+	rules, err := h.pricing.ListRules(requestContext(c), false)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list pricing rules"})
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// SaveRule membuat aturan baru, atau memperbarui aturan jika dipanggil dengan parameter :id
+func (h *AdminPricingHandler) SaveRule(c echo.Context) error {
+	rule := new(service.PricingRule)
+	if err := c.Bind(rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if idParam := c.Param("id"); idParam != "" {
+		id, err := primitive.ObjectIDFromHex(idParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule id"})
+		}
+		rule.ID = id
+	} else {
+		rule.ID = primitive.NilObjectID
+	}
+
+	if err := rule.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := h.pricing.SaveRule(requestContext(c), rule); err != nil {
+		if errors.Is(err, service.ErrPricingRuleNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Pricing rule not found"})
+		}
+		requestLogger(c).Error("Failed to save pricing rule", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save pricing rule"})
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule menghapus aturan harga
+func (h *AdminPricingHandler) DeleteRule(c echo.Context) error {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule id"})
+	}
+	if err := h.pricing.DeleteRule(requestContext(c), id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete pricing rule"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Pricing rule deleted"})
+}
+
+// Quote menampilkan simulasi harga untuk siswa tanpa membuat invoice
+func (h *AdminPricingHandler) Quote(c echo.Context) error {
+	var student *model.Student
+	var err error
+	if id := c.QueryParam("student_id"); id != "" {
+		student, err = model.GetStudentByID(requestContext(c), id)
+	} else if email := c.QueryParam("email"); email != "" {
+		student, err = model.GetStudentByEmail(requestContext(c), email)
+	} else {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "student_id or email is required"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get students"})
+	}
+	if student == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+	}
+
+	tenant := h.cfg.DefaultTenant()
+	if id := c.QueryParam("tenant_id"); id != "" {
+		tenant = h.cfg.Tenant(id)
+	}
+	if tenant == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown tenant"})
+	}
+
+	paymentFor, _ := strconv.Atoi(c.QueryParam("payment_for"))
+	if paymentFor == 0 {
+		paymentFor = 1
+	}
+
+	quote, err := h.pricing.Quote(requestContext(c), service.PricingInput{
+		TenantID:   tenant.ID,
+		Student:    student,
+		PaymentFor: paymentFor,
+		PromoCode:  c.QueryParam("promo_code"),
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownProgram) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to calculate price"})
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
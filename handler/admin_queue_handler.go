@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// maxQueueLimit membatasi jumlah pesan per request: pesan dead letter bisa berisi lampiran PDF
+// dan semuanya ditahan unacked di memori sampai request selesai
+const maxQueueLimit = 200
+
+type AdminQueueHandler struct {
+	rabbitMQ deadLetterQueue
+}
+
+// deadLetterQueue adalah bagian RabbitMQService yang dipakai endpoint admin dead letter
+type deadLetterQueue interface {
+	DeadLetters(ctx context.Context, limit int) ([]service.DeadLetter, error)
+	RequeueDeadLetters(ctx context.Context, limit int) (int, error)
+}
+
+func NewAdminQueueHandler(rabbitMQ *service.RabbitMQService) *AdminQueueHandler {
+	return &AdminQueueHandler{rabbitMQ: rabbitMQ}
+}
+
+// ListDeadLetters menampilkan pesan di dead letter queue tanpa menghapusnya, ?limit= default 20 maksimal 200
+func (h *AdminQueueHandler) ListDeadLetters(c echo.Context) error {
+	letters, err := h.rabbitMQ.DeadLetters(requestContext(c), queryLimit(c, 20))
+	if err != nil {
+		requestLogger(c).Error("Failed to read dead letters", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read dead letters"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"count":        len(letters),
+		"dead_letters": letters,
+	})
+}
+
+// RequeueDeadLetters memindahkan pesan dari dead letter queue ke queue utama, ?limit= default 100 maksimal 200
+func (h *AdminQueueHandler) RequeueDeadLetters(c echo.Context) error {
+	moved, err := h.rabbitMQ.RequeueDeadLetters(requestContext(c), queryLimit(c, 100))
+	if err != nil {
+		requestLogger(c).Error("Failed to requeue dead letters", zap.Int("requeued", moved), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":    "Failed to requeue dead letters",
+			"requeued": moved,
+		})
+	}
+	requestLogger(c).Info("Dead letters requeued", zap.Int("requeued", moved))
+	return c.JSON(http.StatusOK, map[string]int{"requeued": moved})
+}
+
+// queryLimit membaca ?limit=, memakai def jika kosong atau tidak valid, maksimal maxQueueLimit
+func queryLimit(c echo.Context, def int) int {
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil || limit <= 0 {
+		return def
+	}
+	if limit > maxQueueLimit {
+		return maxQueueLimit
+	}
+	return limit
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"webhook-listener-mekarisign/service"
+)
+
+// fakeDeadLetterQueue memindahkan paling banyak available pesan lalu gagal dengan requeueErr
+type fakeDeadLetterQueue struct {
+	available  int
+	requeueErr error
+	limits     []int
+}
+
+func (q *fakeDeadLetterQueue) DeadLetters(_ context.Context, limit int) ([]service.DeadLetter, error) {
+	q.limits = append(q.limits, limit)
+	return make([]service.DeadLetter, min(limit, q.available)), nil
+}
+
+func (q *fakeDeadLetterQueue) RequeueDeadLetters(_ context.Context, limit int) (int, error) {
+	q.limits = append(q.limits, limit)
+	return min(limit, q.available), q.requeueErr
+}
+
+func TestRequeueDeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		available    int
+		requeueErr   error
+		wantCode     int
+		wantLimit    int
+		wantRequeued float64
+	}{
+		{"default limit", "/admin/queue/dead-letters/requeue", 150, nil, http.StatusOK, 100, 100},
+		{"limit above cap", "/admin/queue/dead-letters/requeue?limit=5000", 500, nil, http.StatusOK, maxQueueLimit, maxQueueLimit},
+		{"invalid limit", "/admin/queue/dead-letters/requeue?limit=-3", 2, nil, http.StatusOK, 100, 2},
+		{"partial failure reports requeued count", "/admin/queue/dead-letters/requeue?limit=10", 4, errFake, http.StatusInternalServerError, 10, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &fakeDeadLetterQueue{available: tt.available, requeueErr: tt.requeueErr}
+			h := &AdminQueueHandler{rabbitMQ: queue}
+
+			code, resp := callHandler(t, http.MethodPost, "/admin/queue/dead-letters/requeue", tt.target, h.RequeueDeadLetters, "")
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%v)", code, tt.wantCode, resp)
+			}
+			if len(queue.limits) != 1 || queue.limits[0] != tt.wantLimit {
+				t.Errorf("limit passed to queue = %v, want %d", queue.limits, tt.wantLimit)
+			}
+			if resp["requeued"] != tt.wantRequeued {
+				t.Errorf("requeued = %v, want %v", resp["requeued"], tt.wantRequeued)
+			}
+		})
+	}
+}
+
+func TestListDeadLetters(t *testing.T) {
+	queue := &fakeDeadLetterQueue{available: 300}
+	h := &AdminQueueHandler{rabbitMQ: queue}
+
+	code, resp := callHandler(t, http.MethodGet, "/admin/queue/dead-letters", "/admin/queue/dead-letters?limit=1000", h.ListDeadLetters, "")
+	if code != http.StatusOK || resp["count"] != float64(maxQueueLimit) {
+		t.Errorf("status = %d, count = %v, want %d messages", code, resp["count"], maxQueueLimit)
+	}
+}
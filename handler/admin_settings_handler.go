@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type AdminSettingsHandler struct {
+	settings settingsStore
+	cfg      *config.Config
+}
+
+// settingsStore adalah bagian SettingsService yang dipakai endpoint admin pengaturan
+type settingsStore interface {
+	settingsReader
+	Overrides(tenantID string) service.Settings
+	Update(ctx context.Context, tenantID string, upd service.SettingsUpdate, actor string) (service.Settings, error)
+	AuditLog(ctx context.Context, tenantID string, limit int64) ([]service.SettingsAudit, error)
+}
+
+func NewAdminSettingsHandler(settings *service.SettingsService, cfg *config.Config) *AdminSettingsHandler {
+	return &AdminSettingsHandler{settings: settings, cfg: cfg}
+}
+
+// GetSettings menampilkan pengaturan efektif tenant beserta nilai yang di-override di database
+func (h *AdminSettingsHandler) GetSettings(c echo.Context) error {
+	tenant := h.cfg.Tenant(c.Param("tenant"))
+	if tenant == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown tenant"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"effective": h.settings.Get(tenant),
+		"overrides": h.settings.Overrides(tenant.ID),
+	})
+}
+
+// UpdateSettings mengubah sebagian pengaturan tenant, perubahan langsung berlaku tanpa restart
+func (h *AdminSettingsHandler) UpdateSettings(c echo.Context) error {
+	tenant := h.cfg.Tenant(c.Param("tenant"))
+	if tenant == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown tenant"})
+	}
+
+	actor := adminActor(c)
+	if actor == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": personalKeyRequired})
+	}
+
+	upd := new(service.SettingsUpdate)
+	if err := c.Bind(upd); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if _, err := h.settings.Update(requestContext(c), tenant.ID, *upd, actor); err != nil {
+		var invalid *service.SettingsValidationError
+		switch {
+		case errors.As(err, &invalid):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, service.ErrSettingsConflict):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		requestLogger(c).Error("Failed to update settings", zap.String("tenant", tenant.ID), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update settings"})
+	}
+
+	requestLogger(c).Info("Settings updated", zap.String("tenant", tenant.ID), zap.String("changed_by", actor))
+	return c.JSON(http.StatusOK, h.settings.Get(tenant))
+}
+
+// GetAuditLog menampilkan riwayat perubahan pengaturan tenant
+func (h *AdminSettingsHandler) GetAuditLog(c echo.Context) error {
+	tenant := h.cfg.Tenant(c.Param("tenant"))
+	if tenant == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown tenant"})
+	}
+
+	limit, _ := strconv.ParseInt(c.QueryParam("limit"), 10, 64)
+	if limit <= 0 {
+		limit = 50
+	}
+
+	entries, err := h.settings.AuditLog(requestContext(c), tenant.ID, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read settings audit"})
+	}
+	return c.JSON(http.StatusOK, entries)
+}
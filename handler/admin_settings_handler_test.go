@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fakeSettingsStore mengembalikan updateErr dari Update dan mencatat perubahan yang diterima
+type fakeSettingsStore struct {
+	updateErr error
+	updates   []service.SettingsUpdate
+}
+
+func (s *fakeSettingsStore) Get(t *config.Tenant) service.Settings {
+	return service.Settings{TenantID: t.ID}
+}
+
+func (s *fakeSettingsStore) Overrides(tenantID string) service.Settings {
+	return service.Settings{TenantID: tenantID}
+}
+
+func (s *fakeSettingsStore) Update(_ context.Context, tenantID string, upd service.SettingsUpdate, _ string) (service.Settings, error) {
+	if s.updateErr != nil {
+		return service.Settings{}, s.updateErr
+	}
+	s.updates = append(s.updates, upd)
+	return service.Settings{TenantID: tenantID}, nil
+}
+
+func (s *fakeSettingsStore) AuditLog(context.Context, string, int64) ([]service.SettingsAudit, error) {
+	return nil, nil
+}
+
+func withActor(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(AdminActorKey, name)
+			return next(c)
+		}
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		actor     string
+		body      string
+		updateErr error
+		wantCode  int
+	}{
+		{"updated", "/admin/goglobal/settings", "budi", `{"whatsapp_template_id":"tpl-2","version":3}`, nil, http.StatusOK},
+		{"unknown tenant", "/admin/lpk_x/settings", "budi", `{}`, nil, http.StatusNotFound},
+		{"shared admin key", "/admin/goglobal/settings", "", `{"whatsapp_template_id":"tpl-2"}`, nil, http.StatusForbidden},
+		{"invalid JSON", "/admin/goglobal/settings", "budi", `{"version":"tiga"}`, nil, http.StatusBadRequest},
+		{"invalid value", "/admin/goglobal/settings", "budi", `{"whatsapp_notification_number":"0812"}`, &service.SettingsValidationError{}, http.StatusBadRequest},
+		{"version conflict", "/admin/goglobal/settings", "budi", `{"whatsapp_template_id":"tpl-2","version":2}`, service.ErrSettingsConflict, http.StatusConflict},
+		{"storage failure", "/admin/goglobal/settings", "budi", `{"whatsapp_template_id":"tpl-2"}`, errFake, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeSettingsStore{updateErr: tt.updateErr}
+			h := &AdminSettingsHandler{settings: store, cfg: testConfig}
+
+			code, resp := callHandler(t, http.MethodPut, "/admin/:tenant/settings", tt.target, h.UpdateSettings, tt.body, withActor(tt.actor))
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%v)", code, tt.wantCode, resp)
+			}
+			if code == http.StatusOK && (len(store.updates) != 1 || *store.updates[0].Version != 3) {
+				t.Errorf("update passed to settings = %+v", store.updates)
+			}
+		})
+	}
+}
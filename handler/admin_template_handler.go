@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"net/mail"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// templateTestMessageType adalah jenis pesan untuk email uji, dikirim dengan routing key notify.email.template_test
+const templateTestMessageType = "template_test"
+
+type AdminTemplateHandler struct {
+	templates *service.TemplateRegistry
+	rabbitMQ  *service.RabbitMQService
+	cfg       *config.Config
+}
+
+func NewAdminTemplateHandler(templates *service.TemplateRegistry, rabbitMQ *service.RabbitMQService, cfg *config.Config) *AdminTemplateHandler {
+	return &AdminTemplateHandler{templates: templates, rabbitMQ: rabbitMQ, cfg: cfg}
+}
+
+// templatePreviewRequest berisi data yang menimpa contoh data, key yang tidak diisi tetap memakai contoh
+type templatePreviewRequest struct {
+	Data service.TemplateData `json:"data"`
+}
+
+type templateTestRequest struct {
+	To      string               `json:"to"`
+	Subject string               `json:"subject"`
+	Data    service.TemplateData `json:"data"`
+}
+
+// ListTemplates menampilkan template yang tersedia untuk tenant (bawaan dan override tenant)
+func (h *AdminTemplateHandler) ListTemplates(c echo.Context) error {
+	tenant := h.cfg.Tenant(c.Param("tenant"))
+	if tenant == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown tenant"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tenant":    tenant.ID,
+		"templates": h.templates.Names(tenant),
+	})
+}
+
+// Preview merender template dan mengembalikan HTML-nya. GET memakai contoh data,
+// POST menerima {"data": {...}} untuk mengganti sebagian atau seluruh contoh data.
+func (h *AdminTemplateHandler) Preview(c echo.Context) error {
+	tenant, name, notFound := h.lookup(c)
+	if notFound != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": notFound})
+	}
+
+	var req templatePreviewRequest
+	if c.Request().Method == http.MethodPost {
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+	}
+
+	html, err := h.templates.Render(tenant, name, h.data(tenant, name, req.Data))
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.HTML(http.StatusOK, html)
+}
+
+// SendTest merender template lalu mempublish email ke alamat uji lewat RabbitMQ, tanpa melalui outbox
+func (h *AdminTemplateHandler) SendTest(c echo.Context) error {
+	tenant, name, notFound := h.lookup(c)
+	if notFound != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": notFound})
+	}
+
+	actor := adminActor(c)
+	if actor == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": personalKeyRequired})
+	}
+
+	var req templateTestRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if _, err := mail.ParseAddress(req.To); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be a valid email address"})
+	}
+	if req.Subject == "" {
+		req.Subject = "[TEST] " + name
+	}
+
+	payload, err := h.templates.BuildEmail(tenant, req.To, req.Subject, name, h.data(tenant, name, req.Data))
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	meta := service.MessageMeta{Type: templateTestMessageType, TenantID: tenant.ID}
+	if err := h.rabbitMQ.PublishJSON(requestContext(c), meta, payload); err != nil {
+		requestLogger(c).Error("Failed to publish test email", zap.String("template", name), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to publish test email"})
+	}
+
+	requestLogger(c).Info("Test email published",
+		zap.String("tenant", tenant.ID), zap.String("template", name), zap.String("sent_by", actor))
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status":   "queued",
+		"template": name,
+		"to":       req.To,
+	})
+}
+
+// lookup mengambil tenant dan nama template dari path, atau pesan error jika salah satunya tidak ada
+func (h *AdminTemplateHandler) lookup(c echo.Context) (*config.Tenant, string, string) {
+	tenant := h.cfg.Tenant(c.Param("tenant"))
+	if tenant == nil {
+		return nil, "", "Unknown tenant"
+	}
+	name := c.Param("name")
+	if !h.templates.Has(tenant, name) {
+		return nil, "", "Unknown template"
+	}
+	return tenant, name, ""
+}
+
+// data menggabungkan contoh data dengan data dari request
+func (h *AdminTemplateHandler) data(tenant *config.Tenant, name string, supplied service.TemplateData) service.TemplateData {
+	data := h.templates.SampleData(tenant, name)
+	for k, v := range supplied {
+		data[k] = v
+	}
+	return data
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"webhook-listener-mekarisign/config"
+)
+
+// Format external ID: q<pembayaran ke>-<id tenant>-<id dokumen MekariSign>[-v<versi>]
+var externalIDPattern = regexp.MustCompile(`^q(\d+)-([A-Za-z0-9_]+)-(.+?)(?:-v(\d+))?$`)
+
+type externalIDParts struct {
+	PaymentFor int
+	TenantID   string
+	DataID     string
+	Version    int
+}
+
+func buildExternalID(tenantID string, paymentFor int, dataID string, version int) string {
+	if version <= 1 {
+		return fmt.Sprintf("q%d-%s-%s", paymentFor, tenantID, dataID)
+	}
+	return fmt.Sprintf("q%d-%s-%s-v%d", paymentFor, tenantID, dataID, version)
+}
+
+// parseExternalID memecah external ID menjadi nomor pembayaran, tenant, ID dokumen dan versi invoice
+func parseExternalID(externalID string) (externalIDParts, bool) {
+	m := externalIDPattern.FindStringSubmatch(externalID)
+	if m == nil {
+		return externalIDParts{}, false
+	}
+	parts := externalIDParts{TenantID: m[2], DataID: m[3], Version: 1}
+	parts.PaymentFor, _ = strconv.Atoi(m[1])
+	if m[4] != "" {
+		parts.Version, _ = strconv.Atoi(m[4])
+	}
+	return parts, true
+}
+
+// tenantExternalIDPrefixes adalah prefix external ID untuk invoice yang dibuat oleh createInvoiceForMekariSign
+func tenantExternalIDPrefixes(t *config.Tenant) []string {
+	return []string{
+		fmt.Sprintf("q1-%s-", t.ID),
+		fmt.Sprintf("q2-%s-", t.ID),
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import "testing"
+
+func TestBuildExternalID(t *testing.T) {
+	tests := []struct {
+		tenant     string
+		paymentFor int
+		dataID     string
+		version    int
+		want       string
+	}{
+		{"goglobal", 1, "abc123", 1, "q1-goglobal-abc123"},
+		{"goglobal", 2, "abc123", 0, "q2-goglobal-abc123"},
+		{"goglobal", 1, "abc123", 2, "q1-goglobal-abc123-v2"},
+		{"lpk_b", 2, "9f1c-4a2e-b7d0", 10, "q2-lpk_b-9f1c-4a2e-b7d0-v10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := buildExternalID(tt.tenant, tt.paymentFor, tt.dataID, tt.version); got != tt.want {
+				t.Errorf("buildExternalID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExternalID(t *testing.T) {
+	tests := []struct {
+		externalID string
+		want       externalIDParts
+		ok         bool
+	}{
+		// external ID lama tanpa versi dianggap versi 1
+		{"q1-goglobal-abc123", externalIDParts{PaymentFor: 1, TenantID: "goglobal", DataID: "abc123", Version: 1}, true},
+		{"q2-goglobal-9f1c-4a2e-b7d0", externalIDParts{PaymentFor: 2, TenantID: "goglobal", DataID: "9f1c-4a2e-b7d0", Version: 1}, true},
+		{"q1-goglobal-abc123-v2", externalIDParts{PaymentFor: 1, TenantID: "goglobal", DataID: "abc123", Version: 2}, true},
+		{"q2-lpk_b-9f1c-4a2e-b7d0-v10", externalIDParts{PaymentFor: 2, TenantID: "lpk_b", DataID: "9f1c-4a2e-b7d0", Version: 10}, true},
+		{"q1-goglobal-abc-vx", externalIDParts{PaymentFor: 1, TenantID: "goglobal", DataID: "abc-vx", Version: 1}, true},
+		{"invoice-123", externalIDParts{}, false},
+		{"q1-goglobal", externalIDParts{}, false},
+		{"", externalIDParts{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.externalID, func(t *testing.T) {
+			got, ok := parseExternalID(tt.externalID)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseExternalID(%q) = %+v, %v, want %+v, %v", tt.externalID, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExternalIDRoundTrip(t *testing.T) {
+	for version := 1; version <= 3; version++ {
+		id := buildExternalID("goglobal", 2, "9f1c-4a2e", version)
+		parts, ok := parseExternalID(id)
+		if !ok || parts.Version != version || parts.DataID != "9f1c-4a2e" || parts.PaymentFor != 2 || parts.TenantID != "goglobal" {
+			t.Errorf("round trip of %q = %+v, %v", id, parts, ok)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	invoice "github.com/xendit/xendit-go/v6/invoice"
+)
+
+var errFake = errors.New("fake failure")
+
+// fakeLedger menyimpan entry ledger di memori. Field *Err membuat operasi terkait gagal.
+type fakeLedger struct {
+	entries        map[string]*service.LedgerEntry
+	recordErr      error
+	markReplaceErr error
+}
+
+func newFakeLedger(entries ...service.LedgerEntry) *fakeLedger {
+	l := &fakeLedger{entries: map[string]*service.LedgerEntry{}}
+	for i := range entries {
+		l.entries[entries[i].ExternalID] = &entries[i]
+	}
+	return l
+}
+
+func (l *fakeLedger) FindByExternalID(_ context.Context, externalID string) (*service.LedgerEntry, error) {
+	if e, ok := l.entries[externalID]; ok {
+		copied := *e
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (l *fakeLedger) Chain(_ context.Context, documentID string, paymentFor int) ([]service.LedgerEntry, error) {
+	var chain []service.LedgerEntry
+	for _, e := range l.entries {
+		if e.DocumentID == documentID && e.PaymentFor == paymentFor {
+			chain = append(chain, *e)
+		}
+	}
+	return chain, nil
+}
+
+func (l *fakeLedger) RecordInvoice(_ context.Context, entry service.LedgerEntry) error {
+	if l.recordErr != nil {
+		return l.recordErr
+	}
+	l.entries[entry.ExternalID] = &entry
+	return nil
+}
+
+func (l *fakeLedger) MarkStatus(_ context.Context, externalID string, status string) error {
+	if e, ok := l.entries[externalID]; ok {
+		e.Status = status
+	}
+	return nil
+}
+
+func (l *fakeLedger) Reserve(_ context.Context, entry service.LedgerEntry) (*service.LedgerEntry, bool, error) {
+	if e, ok := l.entries[entry.ExternalID]; ok {
+		copied := *e
+		return &copied, false, nil
+	}
+	entry.Status = service.LedgerStatusCreating
+	l.entries[entry.ExternalID] = &entry
+	return &entry, true, nil
+}
+
+func (l *fakeLedger) TakeOverReservation(context.Context, string) (bool, error) { return false, nil }
+
+func (l *fakeLedger) Release(_ context.Context, externalID string) error {
+	delete(l.entries, externalID)
+	return nil
+}
+
+func (l *fakeLedger) Issued(context.Context, string, time.Time) ([]service.LedgerEntry, error) {
+	return nil, nil
+}
+
+func (l *fakeLedger) MarkProcessed(_ context.Context, externalID string, status string) error {
+	if e, ok := l.entries[externalID]; ok {
+		e.Status, e.CallbackProcessed = status, true
+	}
+	return nil
+}
+
+func (l *fakeLedger) MarkReplaced(_ context.Context, externalID string, replacedBy string, reason string) error {
+	if l.markReplaceErr != nil {
+		return l.markReplaceErr
+	}
+	if e, ok := l.entries[externalID]; ok {
+		e.Status, e.ReplacedBy, e.ChangeReason = service.LedgerStatusReplaced, replacedBy, reason
+	}
+	return nil
+}
+
+// fakeGateway meniru Xendit untuk satu invoice dan mencatat urutan panggilan
+type fakeGateway struct {
+	invoice   invoice.Invoice
+	createErr error
+	calls     []string
+}
+
+func (g *fakeGateway) GetInvoice(context.Context, string) (*invoice.Invoice, error) {
+	g.calls = append(g.calls, "get")
+	inv := g.invoice
+	return &inv, nil
+}
+
+func (g *fakeGateway) ExpireInvoice(context.Context, string) (*invoice.Invoice, error) {
+	g.calls = append(g.calls, "expire")
+	g.invoice.Status = invoice.INVOICESTATUS_EXPIRED
+	inv := g.invoice
+	return &inv, nil
+}
+
+func (g *fakeGateway) CreateInvoice(_ context.Context, externalID, payerEmail string, description string, _ *service.CustomerObject, _ string, amount float64, _ string, _ *service.InvoiceOptions) (*invoice.Invoice, error) {
+	g.calls = append(g.calls, "create")
+	if g.createErr != nil {
+		return nil, g.createErr
+	}
+	id := "inv-" + externalID
+	return &invoice.Invoice{Id: &id, ExternalId: externalID, Description: &description, PayerEmail: &payerEmail,
+		Amount: amount, Status: invoice.INVOICESTATUS_PENDING, InvoiceUrl: "https://checkout.xendit.co/web/" + id}, nil
+}
+
+type fakeSettings service.Settings
+
+func (s fakeSettings) Get(*config.Tenant) service.Settings { return service.Settings(s) }
+
+var testConfig = &config.Config{Tenants: []config.Tenant{
+	{ID: "goglobal", Name: "Go Global", XenditCallbackToken: "token-goglobal"},
+	{ID: "lpk_b", Name: "LPK B", XenditCallbackToken: "token-lpk-b"},
+}}
+
+// callHandler memasang handler pada route lalu mengirim request JSON ke target, mengembalikan status dan body
+func callHandler(t *testing.T, method, route, target string, fn echo.HandlerFunc, body string, mw ...echo.MiddlewareFunc) (int, map[string]interface{}) {
+	t.Helper()
+	e := echo.New()
+	e.Add(method, route, fn, mw...)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// withHeader memasang header pada request sebelum handler dipanggil, dipakai bersama callHandler
+func withHeader(key, value string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Request().Header.Set(key, value)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// healthCheckTimeout membatasi lama setiap pengecekan dependency
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck adalah hasil pengecekan satu dependency
+type HealthCheck struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type HealthHandler struct {
+	db       *database.Database
+	rabbitMQ *service.RabbitMQService
+	xendit   map[string]*service.XenditService
+	cfg      *config.Config
+}
+
+func NewHealthHandler(db *database.Database, rabbitMQ *service.RabbitMQService, xendit map[string]*service.XenditService, cfg *config.Config) *HealthHandler {
+	return &HealthHandler{db: db, rabbitMQ: rabbitMQ, xendit: xendit, cfg: cfg}
+}
+
+// Live hanya menandakan proses berjalan, tidak memeriksa dependency
+func (h *HealthHandler) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready memeriksa semua dependency secara paralel dan mengembalikan 503 jika salah satu tidak sehat,
+// sehingga Kubernetes berhenti mengirim traffic ke pod ini
+func (h *HealthHandler) Ready(c echo.Context) error {
+	checks := map[string]func(ctx context.Context) error{
+		"mongo": func(ctx context.Context) error {
+			return h.db.Client.Ping(ctx, nil)
+		},
+		"mysql": func(ctx context.Context) error {
+			if database.DB == nil {
+				return errors.New("mysql is not connected")
+			}
+			return database.DB.PingContext(ctx)
+		},
+		"rabbitmq": func(ctx context.Context) error {
+			return h.rabbitMQ.Healthy()
+		},
+	}
+	if h.cfg.HealthCheckXendit == "true" {
+		for id, xs := range h.xendit {
+			xs := xs
+			checks["xendit."+id] = xs.Ping
+		}
+	}
+
+	results := make(map[string]HealthCheck, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			result := runHealthCheck(requestContext(c), check)
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, r := range results {
+		if r.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+
+	return c.JSON(code, map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+func runHealthCheck(ctx context.Context, check func(ctx context.Context) error) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := HealthCheck{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -2,23 +2,37 @@ package handler
 
 import (
 	"net/http"
+	"net/mail"
+	"strings"
 
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/model"
 	"webhook-listener-mekarisign/service"
 
 	"github.com/labstack/echo/v4"
+	invoice "github.com/xendit/xendit-go/v6/invoice"
+	"go.uber.org/zap"
 )
 
+// defaultInvoiceDuration dipakai jika INVOICE_DURATION tidak diset
+const defaultInvoiceDuration = "432000" // 5 days
+
 type InvoiceHandler struct {
-	xs *service.XenditService
+	xendit   map[string]*service.XenditService
+	ledger   *service.LedgerService
+	settings *service.SettingsService
+	cfg      *config.Config
 }
 
-func NewInvoiceHandler(xs *service.XenditService) *InvoiceHandler {
-	return &InvoiceHandler{xs: xs}
+func NewInvoiceHandler(xendit map[string]*service.XenditService, ledger *service.LedgerService, settings *service.SettingsService, cfg *config.Config) *InvoiceHandler {
+	return &InvoiceHandler{xendit: xendit, ledger: ledger, settings: settings, cfg: cfg}
 }
 
 func (h *InvoiceHandler) CreateInvoice(c echo.Context) error {
 	type Request struct {
+		TenantID    string  `json:"tenant_id"` // Optional, default tenant pertama
 		ExternalID  string  `json:"external_id"`
+		StudentID   string  `json:"student_id"` // salah satu dari student_id atau payer_email wajib diisi
 		PayerEmail  string  `json:"payer_email"`
 		Description string  `json:"description"`
 		Amount      float64 `json:"amount"`
@@ -30,23 +44,169 @@ func (h *InvoiceHandler) CreateInvoice(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 	}
 
-	// Create customer object
-	customer := &service.CustomerObject{
-		Id:           "CUST-789",
-		PhoneNumber:  "+628111222333",
-		GivenNames:   "Budi",
-		Surname:      "Santoso",
-		Email:        "budi@example.com",
-		MobileNumber: "+628111222333",
-		CustomerId:   "CUST-789",
+	req.ExternalID = strings.TrimSpace(req.ExternalID)
+	req.PayerEmail = strings.TrimSpace(req.PayerEmail)
+
+	if req.ExternalID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "external_id is required"})
+	}
+	if req.Amount <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Amount must be greater than zero"})
+	}
+	if req.Description == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "description is required"})
+	}
+	if req.StudentID == "" && req.PayerEmail == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "student_id or payer_email is required"})
+	}
+	if req.PayerEmail != "" {
+		if _, err := mail.ParseAddress(req.PayerEmail); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid payer_email"})
+		}
+	}
+
+	tenant := h.cfg.DefaultTenant()
+	if req.TenantID != "" {
+		tenant = h.cfg.Tenant(req.TenantID)
+	}
+	if tenant == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown tenant"})
+	}
+
+	ctx := requestContext(c)
+
+	// ambil data siswa sebagai customer
+	var student *model.Student
+	var err error
+	if req.StudentID != "" {
+		student, err = model.GetStudentByID(ctx, req.StudentID)
+	} else {
+		student, err = model.GetStudentByEmail(ctx, req.PayerEmail)
+	}
+	if err != nil {
+		requestLogger(c).Error("CreateInvoice => Failed to get students", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get students"})
+	}
+	if student == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+	}
+
+	// student_id dan payer_email yang diisi bersamaan harus milik siswa yang sama
+	if req.StudentID != "" && req.PayerEmail != "" && !strings.EqualFold(req.PayerEmail, strings.TrimSpace(student.Email.String)) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "payer_email does not match the student's email"})
+	}
+
+	payerEmail := req.PayerEmail
+	if payerEmail == "" {
+		payerEmail = student.Email.String
+	}
+	if _, err := mail.ParseAddress(payerEmail); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Student has no valid email"})
+	}
+
+	customer := studentCustomer(student, req.ExternalID)
+	customer.Email = payerEmail
+
+	invDuration := h.settings.Get(tenant).InvoiceDuration
+	if invDuration == "" {
+		invDuration = defaultInvoiceDuration
 	}
 
-	InvoiceDuration := "432000" // 5 days
+	entry := service.LedgerEntry{
+		TenantID:    tenant.ID,
+		ExternalID:  req.ExternalID,
+		PayerEmail:  payerEmail,
+		PayerName:   student.FullName.String,
+		Description: req.Description,
+		Amount:      req.Amount,
+	}
 
-	invoice, err := h.xs.CreateInvoice(req.ExternalID, req.PayerEmail, req.Description, customer, InvoiceDuration, req.Amount, req.ForUserID)
+	// external ID harus unik, reservasi di ledger dicatat sebelum memanggil Xendit
+	existing, reserved, err := h.ledger.Reserve(ctx, entry)
 	if err != nil {
+		requestLogger(c).Error("Failed to reserve invoice in ledger", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to record invoice"})
+	}
+	if !reserved {
+		if existing == nil || existing.Status != service.LedgerStatusCreating {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "external_id already used"})
+		}
+		takenOver, err := h.ledger.TakeOverReservation(ctx, req.ExternalID)
+		if err != nil {
+			requestLogger(c).Error("Failed to take over invoice reservation", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to record invoice"})
+		}
+		if !takenOver {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Invoice creation is in progress"})
+		}
+		// request sebelumnya mati di tengah jalan, bisa jadi invoice sudah terlanjur dibuat di Xendit
+		inv, err := h.xendit[tenant.ID].FindInvoiceByExternalID(ctx, req.ExternalID)
+		if err != nil {
+			requestLogger(c).Error("Failed to look up invoice", zap.String("external_id", req.ExternalID), zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to look up invoice"})
+		}
+		if inv != nil {
+			requestLogger(c).Info("Adopting invoice created before crash", zap.String("external_id", req.ExternalID))
+			h.recordInvoice(c, entry, inv)
+			return c.JSON(http.StatusOK, inv)
+		}
+	}
+
+	invoice, err := h.xendit[tenant.ID].CreateInvoice(ctx, req.ExternalID, payerEmail, req.Description, customer, invDuration, req.Amount, req.ForUserID, nil)
+	if err != nil {
+		if rerr := h.ledger.Release(ctx, req.ExternalID); rerr != nil {
+			requestLogger(c).Error("Failed to release invoice reservation", zap.Error(rerr))
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
+	h.recordInvoice(c, entry, invoice)
 	return c.JSON(http.StatusOK, invoice)
 }
+
+// recordInvoice melengkapi reservasi ledger dengan data invoice dari Xendit. Kegagalan hanya dicatat di log:
+// invoice sudah dibuat, dan reservasi yang tertinggal diambil alih retry berikutnya lewat FindInvoiceByExternalID.
+func (h *InvoiceHandler) recordInvoice(c echo.Context, entry service.LedgerEntry, inv *invoice.Invoice) {
+	if inv.Id != nil {
+		entry.InvoiceID = *inv.Id
+	}
+	entry.InvoiceURL = inv.InvoiceUrl
+	entry.Status = string(inv.Status)
+	if err := h.ledger.RecordInvoice(requestContext(c), entry); err != nil {
+		requestLogger(c).Error("Failed to record invoice in ledger", zap.Error(err))
+	}
+}
+
+// studentCustomer membuat data customer Xendit dari data siswa
+func studentCustomer(student *model.Student, customerID string) *service.CustomerObject {
+	givenNames, surname := student.FullName.String, " "
+	if i := strings.LastIndex(givenNames, " "); i > 0 {
+		givenNames, surname = givenNames[:i], givenNames[i+1:]
+	}
+
+	phone := sanitizePhone(student.WhatsAppNumber.String)
+
+	return &service.CustomerObject{
+		Id:           customerID,
+		PhoneNumber:  phone,
+		GivenNames:   givenNames,
+		Surname:      surname,
+		Email:        student.Email.String,
+		MobileNumber: phone,
+		CustomerId:   student.ID,
+	}
+}
+
+// sanitizePhone mengubah nomor 08xx / 628xx / +628xx menjadi format +628xx yang dikirim ke Xendit.
+// Nomor kosong tetap kosong sehingga tidak dikirim ke Xendit.
+func sanitizePhone(phone string) string {
+	// Remove + if start with +
+	phone = strings.TrimPrefix(strings.TrimSpace(phone), "+")
+	if phone == "" {
+		return ""
+	}
+	if strings.HasPrefix(phone, "08") {
+		phone = "628" + phone[2:]
+	}
+	return "+" + phone
+}
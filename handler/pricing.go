@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/service"
+)
+
+// quoteInvoiceOptions menyusun rincian invoice dari hasil perhitungan harga: biaya kursus dan asrama sebagai item,
+// biaya admin sebagai fee, dan setiap potongan sebagai fee bernilai negatif. Pengaturan metode pembayaran,
+// redirect dan bahasa diambil dari konfigurasi program.
+func quoteInvoiceOptions(quote *service.PriceQuote, program config.ProgramConfig) *service.InvoiceOptions {
+	name := quote.ProgramName
+	if name == "" {
+		name = quote.ProgramType
+	}
+
+	opts := &service.InvoiceOptions{
+		Items: []service.InvoiceItem{{
+			Name:     name,
+			Price:    quote.ListPrice,
+			Quantity: 1,
+			Category: "tuition",
+		}},
+		PaymentMethods:     program.PaymentMethods,
+		SuccessRedirectURL: program.SuccessRedirectURL,
+		FailureRedirectURL: program.FailureRedirectURL,
+		Locale:             program.Locale,
+		Metadata: map[string]interface{}{
+			"program_type": quote.ProgramType,
+			"list_price":   quote.ListPrice,
+		},
+	}
+
+	if quote.Dormitory > 0 {
+		opts.Items = append(opts.Items, service.InvoiceItem{
+			Name:     "Asrama",
+			Price:    quote.Dormitory,
+			Quantity: 1,
+			Category: "dormitory",
+		})
+	}
+	if quote.AdminFee > 0 {
+		opts.Fees = append(opts.Fees, service.InvoiceFee{Type: "Biaya Admin", Value: quote.AdminFee})
+	}
+	for _, adj := range quote.Adjustments {
+		opts.Fees = append(opts.Fees, service.InvoiceFee{Type: adj.Description, Value: adj.Amount})
+	}
+	if quote.PromoCode != "" {
+		opts.Metadata["promo_code"] = quote.PromoCode
+	}
+
+	return opts
+}
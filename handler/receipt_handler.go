@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"webhook-listener-mekarisign/service"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type ReceiptHandler struct {
+	receipts *service.ReceiptService
+}
+
+func NewReceiptHandler(receipts *service.ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{receipts: receipts}
+}
+
+// Download mengirim PDF kuitansi, ID acak pada URL berfungsi sebagai token akses
+func (h *ReceiptHandler) Download(c echo.Context) error {
+	receipt, err := h.receipts.Find(requestContext(c), c.Param("id"))
+	if err != nil {
+		requestLogger(c).Error("Failed to load receipt", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load receipt"})
+	}
+	if receipt == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Receipt not found"})
+	}
+
+	c.Response().Header().Set("Content-Disposition", `inline; filename="`+receipt.FileName()+`"`)
+	return c.Blob(http.StatusOK, "application/pdf", receipt.PDF)
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/service"
+	"webhook-listener-mekarisign/tracing"
+
+	invoice "github.com/xendit/xendit-go/v6/invoice"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// Jenis selisih yang dilaporkan oleh rekonsiliasi
+const (
+	DiscrepancyMissingCallback = "missing_callback"
+	DiscrepancyStatusMismatch  = "status_mismatch"
+	DiscrepancyMissingLedger   = "missing_ledger_entry"
+	DiscrepancyMissingEmail    = "missing_invoice_email"
+)
+
+type ReconcileDiscrepancy struct {
+	ExternalID   string `bson:"external_id" json:"external_id"`
+	InvoiceID    string `bson:"invoice_id" json:"invoice_id"`
+	Kind         string `bson:"kind" json:"kind"`
+	XenditStatus string `bson:"xendit_status" json:"xendit_status"`
+	StoredStatus string `bson:"stored_status" json:"stored_status"`
+	LedgerStatus string `bson:"ledger_status" json:"ledger_status"`
+	Action       string `bson:"action" json:"action"`
+	Error        string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+type ReconcileReport struct {
+	TenantID      string                 `bson:"tenant_id" json:"tenant_id"`
+	StartedAt     time.Time              `bson:"started_at" json:"started_at"`
+	FinishedAt    time.Time              `bson:"finished_at" json:"finished_at"`
+	Since         time.Time              `bson:"since" json:"since"`
+	DryRun        bool                   `bson:"dry_run" json:"dry_run"`
+	Checked       int                    `bson:"checked" json:"checked"`
+	Discrepancies []ReconcileDiscrepancy `bson:"discrepancies" json:"discrepancies"`
+}
+
+// Reconcile membandingkan invoice tenant di Xendit dengan callback yang tersimpan di webhook_xendit dan ledger,
+// lalu memproses ulang callback PAID yang hilang. Jika dryRun true, hanya laporan yang dibuat.
+func (h *WebhookHandler) Reconcile(ctx context.Context, t *config.Tenant, since time.Time, dryRun bool) (*ReconcileReport, error) {
+	if logger.CorrelationID(ctx) == "" {
+		ctx = logger.WithCorrelationID(ctx, logger.NewCorrelationID())
+	}
+	ctx, span := tracing.Start(ctx, "Reconcile", attribute.String("tenant", t.ID), attribute.Bool("dry_run", dryRun))
+	defer span.End()
+
+	report := &ReconcileReport{TenantID: t.ID, StartedAt: time.Now(), Since: since, DryRun: dryRun}
+
+	invoices, err := h.xendit[t.ID].ListInvoices(ctx, since, tenantExternalIDPrefixes(t))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inv := range invoices {
+		report.Checked++
+		if d := h.reconcileInvoice(ctx, t, inv, dryRun); d != nil {
+			report.Discrepancies = append(report.Discrepancies, *d)
+		}
+	}
+
+	report.Discrepancies = append(report.Discrepancies, h.reconcileInvoiceEmails(ctx, t, since, dryRun)...)
+
+	report.FinishedAt = time.Now()
+
+	if _, err := h.db.DB.Collection(service.ReconcileReportCollection).InsertOne(ctx, report); err != nil {
+		logger.FromContext(ctx).Error("Failed to save reconcile report", zap.Error(err))
+	}
+
+	return report, nil
+}
+
+func (h *WebhookHandler) reconcileInvoice(ctx context.Context, t *config.Tenant, inv invoice.Invoice, dryRun bool) *ReconcileDiscrepancy {
+	xenditStatus := string(inv.Status)
+	invoiceID := ""
+	if inv.Id != nil {
+		invoiceID = *inv.Id
+	}
+
+	d := &ReconcileDiscrepancy{ExternalID: inv.ExternalId, InvoiceID: invoiceID, XenditStatus: xenditStatus}
+
+	storedStatus, err := h.storedCallbackStatus(ctx, inv.ExternalId)
+	if err != nil {
+		d.Error = err.Error()
+		d.Action = "skipped"
+		return d
+	}
+	d.StoredStatus = storedStatus
+
+	entry, err := h.ledger.FindByExternalID(ctx, inv.ExternalId)
+	if err != nil {
+		d.Error = err.Error()
+		d.Action = "skipped"
+		return d
+	}
+	if entry != nil {
+		d.LedgerStatus = entry.Status
+	}
+
+	d.Kind = classifyInvoice(xenditStatus, storedStatus, entry)
+	if d.Kind == "" {
+		return nil
+	}
+	if dryRun {
+		d.Action = "none (dry run)"
+		return d
+	}
+
+	switch d.Kind {
+	case DiscrepancyMissingCallback:
+		if entry == nil {
+			h.recordMissingLedgerEntry(ctx, inv, false)
+		}
+		if err := h.synthesizeCallback(ctx, t, inv); err != nil {
+			d.Action = "callback_failed"
+			d.Error = err.Error()
+			return d
+		}
+		d.Action = "callback_synthesized"
+	case DiscrepancyMissingLedger:
+		// callback PAID yang tersimpan untuk invoice tanpa ledger sudah diproses sebelum ledger ada
+		h.recordMissingLedgerEntry(ctx, inv, isPaidStatus(storedStatus))
+		d.Action = "ledger_entry_created"
+	case DiscrepancyStatusMismatch:
+		if err := h.ledger.MarkStatus(ctx, inv.ExternalId, xenditStatus); err != nil {
+			d.Error = err.Error()
+		}
+		d.Action = "ledger_status_updated"
+	}
+
+	return d
+}
+
+// classifyInvoice menentukan jenis selisih antara invoice di Xendit, callback terakhir yang tersimpan dan
+// entry ledger; string kosong berarti tidak ada selisih. Invoice lunas dianggap kehilangan callback selama
+// ledger belum mencatat callback-nya selesai diproses, termasuk callback PAID yang tersimpan tetapi gagal
+// di tengah pemrosesan. Status callback tersimpan hanya dipakai untuk invoice yang belum ada di ledger.
+func classifyInvoice(xenditStatus, storedStatus string, entry *service.LedgerEntry) string {
+	paid := isPaidStatus(xenditStatus)
+	switch {
+	case entry != nil && entry.ReplacedBy != "":
+		// invoice yang sudah diganti sengaja dibiarkan kedaluwarsa
+		return ""
+	case paid && entry != nil && !entry.CallbackProcessed:
+		return DiscrepancyMissingCallback
+	case paid && entry == nil && !isPaidStatus(storedStatus):
+		return DiscrepancyMissingCallback
+	case entry == nil:
+		return DiscrepancyMissingLedger
+	case entry.Status != xenditStatus:
+		return DiscrepancyStatusMismatch
+	}
+	return ""
+}
+
+// reconcileInvoiceEmails mencatat ulang email invoice yang tidak ada di outbox, misalnya karena proses mati
+// setelah invoice dibuat dan sebelum email dicatat
+func (h *WebhookHandler) reconcileInvoiceEmails(ctx context.Context, t *config.Tenant, since time.Time, dryRun bool) []ReconcileDiscrepancy {
+	entries, err := h.ledger.Issued(ctx, t.ID, since)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to read issued invoices", zap.Error(err))
+		return nil
+	}
+
+	var discrepancies []ReconcileDiscrepancy
+	for _, entry := range entries {
+		deliveries, err := h.notifications.Deliveries(ctx, entry.ExternalID)
+		if err != nil || len(deliveries) > 0 {
+			continue
+		}
+		d := ReconcileDiscrepancy{
+			ExternalID:   entry.ExternalID,
+			InvoiceID:    entry.InvoiceID,
+			Kind:         DiscrepancyMissingEmail,
+			LedgerStatus: entry.Status,
+			Action:       "none (dry run)",
+		}
+		if !dryRun {
+			d.Action = "invoice_email_enqueued"
+			if err := h.enqueueInvoiceEmail(ctx, t, entry); err != nil {
+				d.Action = "enqueue_failed"
+				d.Error = err.Error()
+			}
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies
+}
+
+// storedCallbackStatus mengambil status dari callback terakhir yang tersimpan untuk external ID tersebut
+func (h *WebhookHandler) storedCallbackStatus(ctx context.Context, externalID string) (string, error) {
+	var doc struct {
+		Status string `bson:"status"`
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err := h.db.DB.Collection("webhook_xendit").FindOne(ctx, bson.M{"external_id": externalID}, opts).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+	return doc.Status, nil
+}
+
+// recordMissingLedgerEntry mencatat invoice Xendit yang belum ada di ledger. processed menandai callback-nya
+// sudah diproses sehingga rekonsiliasi berikutnya tidak memproses ulang.
+func (h *WebhookHandler) recordMissingLedgerEntry(ctx context.Context, inv invoice.Invoice, processed bool) {
+	entry := service.LedgerEntry{
+		ExternalID: inv.ExternalId,
+		Amount:     inv.Amount,
+		Status:     string(inv.Status),
+	}
+	if inv.Id != nil {
+		entry.InvoiceID = *inv.Id
+	}
+	if inv.PayerEmail != nil {
+		entry.PayerEmail = *inv.PayerEmail
+	}
+	if parts, ok := parseExternalID(inv.ExternalId); ok {
+		entry.TenantID = parts.TenantID
+		entry.PaymentFor = parts.PaymentFor
+		entry.DocumentID = parts.DataID
+		entry.Version = parts.Version
+	}
+
+	if err := h.ledger.RecordInvoice(ctx, entry); err != nil {
+		logger.FromContext(ctx).Error("Failed to record reconciled invoice in ledger", zap.Error(err))
+		return
+	}
+	if processed {
+		h.markCallbackProcessed(ctx, entry.ExternalID, entry.Status)
+	}
+}
+
+// synthesizeCallback menyimpan callback PAID buatan ke webhook_xendit lalu memprosesnya seperti callback asli
+func (h *WebhookHandler) synthesizeCallback(ctx context.Context, t *config.Tenant, inv invoice.Invoice) error {
+	req := map[string]interface{}{
+		"_id":         primitive.NewObjectID(),
+		"tenant_id":   t.ID,
+		"external_id": inv.ExternalId,
+		"status":      string(invoice.INVOICESTATUS_PAID),
+		"amount":      inv.Amount,
+		"reconciled":  true,
+	}
+	if inv.Id != nil {
+		req["id"] = *inv.Id
+	}
+	if inv.Description != nil {
+		req["description"] = *inv.Description
+	}
+	if inv.PayerEmail != nil {
+		req["payer_email"] = *inv.PayerEmail
+	}
+
+	if _, err := h.db.DB.Collection("webhook_xendit").InsertOne(ctx, req); err != nil {
+		return fmt.Errorf("failed to store synthesized callback: %v", err)
+	}
+
+	if res := h.processXenditCallback(ctx, t, req); res.status != http.StatusOK {
+		return fmt.Errorf("callback processing returned %d: %v", res.status, res.body)
+	}
+
+	logger.FromContext(ctx).Info("Synthesized missing Xendit callback", zap.String("external_id", inv.ExternalId))
+	return nil
+}
+
+func isPaidStatus(status string) bool {
+	return status == string(invoice.INVOICESTATUS_PAID) || status == string(invoice.INVOICESTATUS_SETTLED)
+}
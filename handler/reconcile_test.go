@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"webhook-listener-mekarisign/service"
+)
+
+func TestClassifyInvoice(t *testing.T) {
+	tests := []struct {
+		name         string
+		xenditStatus string
+		storedStatus string
+		entry        *service.LedgerEntry
+		want         string
+	}{
+		{"in sync", "PAID", "PAID", &service.LedgerEntry{Status: "PAID", CallbackProcessed: true}, ""},
+		{"pending in sync", "PENDING", "", &service.LedgerEntry{Status: "PENDING"}, ""},
+		{"replaced invoice is ignored", "EXPIRED", "", &service.LedgerEntry{Status: service.LedgerStatusReplaced, ReplacedBy: "q1-goglobal-doc1-v2"}, ""},
+		{"paid without callback", "PAID", "", &service.LedgerEntry{Status: "PENDING"}, DiscrepancyMissingCallback},
+		{"callback stored as paid but never processed", "PAID", "PAID", &service.LedgerEntry{Status: "PAID"}, DiscrepancyMissingCallback},
+		{"settled without ledger entry or callback", "SETTLED", "", nil, DiscrepancyMissingCallback},
+		{"paid callback stored without ledger entry", "PAID", "PAID", nil, DiscrepancyMissingLedger},
+		{"pending without ledger entry", "PENDING", "", nil, DiscrepancyMissingLedger},
+		{"expired but ledger pending", "EXPIRED", "", &service.LedgerEntry{Status: "PENDING"}, DiscrepancyStatusMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyInvoice(tt.xenditStatus, tt.storedStatus, tt.entry); got != tt.want {
+				t.Errorf("classifyInvoice(%q, %q) = %q, want %q", tt.xenditStatus, tt.storedStatus, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessXenditCallback(t *testing.T) {
+	templates, err := service.NewTemplateRegistry(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		req           map[string]interface{}
+		entry         service.LedgerEntry
+		wantCode      int
+		wantStatus    string
+		wantProcessed bool
+	}{
+		{
+			name:     "missing description",
+			req:      map[string]interface{}{"external_id": "q1-goglobal-doc1", "status": "PAID"},
+			entry:    service.LedgerEntry{ExternalID: "q1-goglobal-doc1", Status: "PENDING"},
+			wantCode: http.StatusBadRequest, wantStatus: "PENDING",
+		},
+		{
+			name:     "replaced invoice is ignored",
+			req:      map[string]interface{}{"external_id": "q1-goglobal-doc1", "status": "EXPIRED", "description": "Pembayaran ke-1 Go Global kepada Budi"},
+			entry:    service.LedgerEntry{ExternalID: "q1-goglobal-doc1", Status: service.LedgerStatusReplaced, ReplacedBy: "q1-goglobal-doc1-v2"},
+			wantCode: http.StatusOK, wantStatus: service.LedgerStatusReplaced,
+		},
+		{
+			name:     "paid invoice outside installments is marked processed",
+			req:      map[string]interface{}{"external_id": "inv-manual-1", "status": "PAID", "description": "Biaya asrama"},
+			entry:    service.LedgerEntry{ExternalID: "inv-manual-1", Status: "PENDING"},
+			wantCode: http.StatusOK, wantStatus: "PAID", wantProcessed: true,
+		},
+		{
+			name:     "pending installment is not marked processed",
+			req:      map[string]interface{}{"external_id": "q1-goglobal-doc1", "status": "PENDING", "description": "Pembayaran ke-1 Go Global kepada Budi"},
+			entry:    service.LedgerEntry{ExternalID: "q1-goglobal-doc1", Status: "PENDING"},
+			wantCode: http.StatusOK, wantStatus: "PENDING",
+		},
+		{
+			name:     "paid installment with invalid external id",
+			req:      map[string]interface{}{"external_id": "bukan-external-id", "status": "PAID", "description": "Pembayaran ke-1 Go Global kepada Budi"},
+			entry:    service.LedgerEntry{ExternalID: "bukan-external-id", Status: "PENDING"},
+			wantCode: http.StatusBadRequest, wantStatus: "PAID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newFakeLedger(tt.entry)
+			h := &WebhookHandler{cfg: testConfig, templates: templates, ledger: ledger, settings: fakeSettings{}}
+
+			res := h.processXenditCallback(context.Background(), &testConfig.Tenants[0], tt.req)
+			if res.status != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%v)", res.status, tt.wantCode, res.body)
+			}
+			entry := ledger.entries[tt.entry.ExternalID]
+			if entry.Status != tt.wantStatus {
+				t.Errorf("ledger status = %s, want %s", entry.Status, tt.wantStatus)
+			}
+			if entry.CallbackProcessed != tt.wantProcessed {
+				t.Errorf("callback processed = %v, want %v", entry.CallbackProcessed, tt.wantProcessed)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/tracing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// AdminActorKey adalah key echo.Context berisi nama pemilik key admin per orang, diisi oleh middleware admin
+const AdminActorKey = "admin_actor"
+
+// adminActor mengembalikan nama admin dari key yang dipakai, kosong jika request memakai key admin bersama
+func adminActor(c echo.Context) string {
+	name, _ := c.Get(AdminActorKey).(string)
+	return name
+}
+
+// personalKeyRequired adalah pesan 403 untuk perubahan yang dicatat di audit trail tetapi memakai key admin bersama
+const personalKeyRequired = "A personal admin key (ADMIN_API_KEYS) is required for this action"
+
+// requestContext mengembalikan context request yang membawa correlation ID. Pembatalan request
+// tidak diteruskan agar proses yang sudah berjalan (invoice, ledger, email) tidak terputus di tengah.
+func requestContext(c echo.Context) context.Context {
+	return context.WithoutCancel(c.Request().Context())
+}
+
+// startSpan membuat span anak untuk satu langkah pemrosesan request dan memasangnya di context request,
+// sehingga panggilan berikutnya lewat requestContext(c) menjadi anak span ini. Fungsi yang dikembalikan
+// menutup span dan memulihkan context sebelumnya:
+//
+//	defer startSpan(c, "handleMekariSignWebhook")()
+func startSpan(c echo.Context, name string, attrs ...attribute.KeyValue) func() {
+	req := c.Request()
+	ctx, span := tracing.Start(req.Context(), name, attrs...)
+	c.SetRequest(req.WithContext(ctx))
+
+	return func() {
+		endSpan(span, c.Response().Status)
+		c.SetRequest(req)
+	}
+}
+
+// endSpan menutup span dan menandainya error jika status balasan 5xx
+func endSpan(span trace.Span, status int) {
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// requestLogger mengembalikan logger dengan correlation ID request
+func requestLogger(c echo.Context) *zap.Logger {
+	return logger.FromContext(c.Request().Context())
+}
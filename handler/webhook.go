@@ -4,30 +4,58 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
 
 	"webhook-listener-mekarisign/config"
 	"webhook-listener-mekarisign/database"
 	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/metrics"
 	"webhook-listener-mekarisign/model"
 	"webhook-listener-mekarisign/service"
+	"webhook-listener-mekarisign/tracing"
 
-	"github.com/dustin/go-humanize"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type WebhookHandler struct {
-	db       *database.Database
-	xs       *service.XenditService
-	cfg      *config.Config
-	rabbitMQ *service.RabbitMQService
+	db            *database.Database
+	xendit        map[string]*service.XenditService
+	cfg           *config.Config
+	templates     *service.TemplateRegistry
+	notifications *service.NotificationService
+	staff         *service.StaffNotificationService
+	receipts      *service.ReceiptService
+	ledger        webhookLedger
+	pricing       *service.PricingService
+	settings      settingsReader
+}
+
+// webhookLedger adalah bagian LedgerService yang dipakai pemrosesan webhook dan rekonsiliasi
+type webhookLedger interface {
+	invoiceLedger
+	Reserve(ctx context.Context, entry service.LedgerEntry) (*service.LedgerEntry, bool, error)
+	TakeOverReservation(ctx context.Context, externalID string) (bool, error)
+	Release(ctx context.Context, externalID string) error
+	Issued(ctx context.Context, tenantID string, since time.Time) ([]service.LedgerEntry, error)
+	MarkProcessed(ctx context.Context, externalID string, status string) error
+}
+
+// webhookResponse adalah status dan body balasan untuk pengirim webhook. Pemrosesan callback
+// mengembalikan nilai ini alih-alih menulis ke echo.Context agar bisa dipanggil ulang oleh rekonsiliasi.
+type webhookResponse struct {
+	status int
+	body   interface{}
 }
 
 type InvoiceData struct {
@@ -87,11 +115,17 @@ var mekariSignData struct {
 	} `bson:"data"`
 }
 
-func NewWebhookHandler(db *database.Database, xs *service.XenditService, cfg *config.Config, rabbitMQ *service.RabbitMQService) *WebhookHandler {
-	return &WebhookHandler{db: db, xs: xs, cfg: cfg, rabbitMQ: rabbitMQ}
+func NewWebhookHandler(db *database.Database, xendit map[string]*service.XenditService, cfg *config.Config, templates *service.TemplateRegistry, notifications *service.NotificationService, staff *service.StaffNotificationService, receipts *service.ReceiptService, ledger *service.LedgerService, pricing *service.PricingService, settings *service.SettingsService) *WebhookHandler {
+	return &WebhookHandler{db: db, xendit: xendit, cfg: cfg, templates: templates, notifications: notifications, staff: staff, receipts: receipts, ledger: ledger, pricing: pricing, settings: settings}
 }
 
 func (h *WebhookHandler) HandleWebhook(c echo.Context) error {
+	start, provider := time.Now(), "unknown"
+	defer func() {
+		metrics.ObserveWebhook(provider, c.Response().Status, time.Since(start))
+	}()
+	defer startSpan(c, "HandleWebhook")()
+
 	var req map[string]interface{}
 
 	// Parsing JSON request
@@ -99,7 +133,7 @@ func (h *WebhookHandler) HandleWebhook(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
 	}
 
-	logger.NewLogger().Info("Webhook received", zap.Any("request", req))
+	requestLogger(c).Info("Webhook received", zap.Any("request", req))
 
 	// ensure _id is an ObjectID
 	if req["_id"] == nil {
@@ -111,36 +145,64 @@ func (h *WebhookHandler) HandleWebhook(c echo.Context) error {
 	}
 
 	collectionName := h.getCollectionName(req)
-	collection := h.db.DB.Collection(collectionName)
+	provider = strings.TrimPrefix(collectionName, "webhook_")
+
+	tenant := h.resolveTenant(c, req)
+	if tenant == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown tenant"})
+	}
+	req["tenant_id"] = tenant.ID
+	trace.SpanFromContext(requestContext(c)).SetAttributes(
+		attribute.String("webhook.provider", provider),
+		attribute.String("tenant", tenant.ID),
+	)
 
 	// validation untuk xendit webhook
 	if collectionName == "webhook_xendit" {
 		token := c.Request().Header.Get("x-callback-token")
-		if token == "" || token != h.cfg.XenditCallbackToken {
-			logger.NewLogger().Warn("Unauthorized Xendit webhook request", zap.String("received_token", token))
+		if token == "" || token != tenant.XenditCallbackToken {
+			requestLogger(c).Warn("Unauthorized Xendit webhook request", zap.String("tenant", tenant.ID), zap.String("received_token", token))
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
 		}
 	}
 
 	// Simpan ke MongoDB
+	collection := h.db.DB.Collection(collectionName)
 	filter := bson.M{"_id": req["_id"]}
 	update := bson.M{"$set": req}
 	opts := options.Update().SetUpsert(true)
-	res, err := collection.UpdateOne(context.Background(), filter, update, opts)
+	res, err := collection.UpdateOne(requestContext(c), filter, update, opts)
 	if err != nil {
-		logger.NewLogger().Error("Failed to save to database", zap.Error(err))
+		requestLogger(c).Error("Failed to save to database", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save to database"})
 	}
 
 	if collectionName == "webhook_mekarisign" {
-		return h.handleMekariSignWebhook(req, res.UpsertedID, c)
+		return h.handleMekariSignWebhook(tenant, req, res.UpsertedID, c)
 	} else if collectionName == "webhook_xendit" {
-		return h.handleXenditWebhook(req, c)
+		res := h.processXenditCallback(requestContext(c), tenant, req)
+		return c.JSON(res.status, res.body)
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook received"})
 }
 
+// resolveTenant menentukan tenant dari parameter URL /webhook/:tenant, lalu dari external ID invoice Xendit,
+// dan terakhir memakai tenant default untuk webhook lama yang dikirim ke /webhook
+func (h *WebhookHandler) resolveTenant(c echo.Context, req map[string]interface{}) *config.Tenant {
+	if id := c.Param("tenant"); id != "" {
+		return h.cfg.Tenant(id)
+	}
+	if externalID, ok := req["external_id"].(string); ok {
+		if parts, ok := parseExternalID(externalID); ok {
+			if t := h.cfg.Tenant(parts.TenantID); t != nil {
+				return t
+			}
+		}
+	}
+	return h.cfg.DefaultTenant()
+}
+
 func (h *WebhookHandler) getCollectionName(req map[string]interface{}) string {
 	if req["external_id"] != nil {
 		return "webhook_xendit"
@@ -150,7 +212,9 @@ func (h *WebhookHandler) getCollectionName(req map[string]interface{}) string {
 	return "webhook_logs"
 }
 
-func (h *WebhookHandler) handleMekariSignWebhook(req map[string]interface{}, insertedID interface{}, c echo.Context) error {
+func (h *WebhookHandler) handleMekariSignWebhook(t *config.Tenant, req map[string]interface{}, insertedID interface{}, c echo.Context) error {
+	defer startSpan(c, "handleMekariSignWebhook")()
+
 	data, ok := req["data"].(map[string]interface{})
 	if !ok {
 		return c.JSON(http.StatusOK, bson.M{"message": "Webhook received but no invoice created", "inserted_id": insertedID})
@@ -172,7 +236,7 @@ func (h *WebhookHandler) handleMekariSignWebhook(req map[string]interface{}, ins
 	signers, _ := attributes["signers"].([]interface{})
 	for i := 0; i < len(signers); i++ {
 		signer, _ := signers[i].(map[string]interface{})
-		if signer["email"] == h.cfg.DirectorMail {
+		if email, _ := signer["email"].(string); t.IsDirector(email) {
 			signers = append(signers[:i], signers[i+1:]...)
 			i--
 		}
@@ -181,9 +245,9 @@ func (h *WebhookHandler) handleMekariSignWebhook(req map[string]interface{}, ins
 	if len(signers) > 0 {
 		payerEmail, _ := signers[0].(map[string]interface{})["email"].(string)
 		// get student data
-		student, err := model.GetStudentByEmail(payerEmail)
+		student, err := model.GetStudentByEmail(requestContext(c), payerEmail)
 		if student == nil {
-			logger.NewLogger().Error("pushToStudentAttachment => Failed to get students", zap.Error(err))
+			requestLogger(c).Error("pushToStudentAttachment => Failed to get students", zap.Error(err))
 		}
 
 		var studentID sql.NullString
@@ -195,12 +259,6 @@ func (h *WebhookHandler) handleMekariSignWebhook(req map[string]interface{}, ins
 
 		now := time.Now()
 
-		// logger.NewLogger().Info("pushToStudentAttachment", zap.String("docId", docId))
-		// logger.NewLogger().Info("pushToStudentAttachment", zap.String("docUrl", docUrl))
-		// logger.NewLogger().Info("pushToStudentAttachment", zap.String("fileName", fileName))
-		// logger.NewLogger().Info("pushToStudentAttachment", zap.String("payerEmail", payerEmail))
-		// logger.NewLogger().Info("pushToStudentAttachment", zap.String("studentID", studentID.String))
-
 		// create student attachment
 		studentAttachment := model.StudentAttachment{
 			ID:         docId,
@@ -214,27 +272,48 @@ func (h *WebhookHandler) handleMekariSignWebhook(req map[string]interface{}, ins
 		}
 
 		// save to database
-		_, err = model.CreateOrUpdateStudentAttachment(studentAttachment)
+		_, err = model.CreateOrUpdateStudentAttachment(requestContext(c), studentAttachment)
 		if err != nil {
-			logger.NewLogger().Error("pushToStudentAttachment => Failed to save student attachment", zap.Error(err))
+			requestLogger(c).Error("pushToStudentAttachment => Failed to save student attachment", zap.Error(err))
 		}
 	}
 
 	if signingStatus == "completed" && stampingStatus == "success" {
 		if len(signers) > 0 {
-			return h.createInvoiceForMekariSign(signers[0], data["id"].(string), 1, c)
+			signer, _ := signers[0].(map[string]interface{})
+			signerName, _ := signer["name"].(string)
+			signerEmail, _ := signer["email"].(string)
+			err := h.staff.Notify(requestContext(c), service.StaffEvent{
+				Key:    docId,
+				Event:  config.EventContractSigned,
+				Tenant: t,
+				Item: service.StaffDigestItem{
+					Description: fileName,
+					Name:        signerName,
+					Email:       signerEmail,
+					Link:        "https://api.mekari.com" + docUrl,
+					OccurredAt:  time.Now(),
+				},
+			})
+			if err != nil {
+				requestLogger(c).Error("Failed to enqueue contract signed notification", zap.Error(err))
+			}
+			res := h.createInvoiceForMekariSign(requestContext(c), t, signers[0], data["id"].(string), 1)
+			return c.JSON(res.status, res.body)
 		}
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook received but no invoice created"})
 }
 
-func (h *WebhookHandler) createInvoiceForMekariSign(signer interface{}, dataID string, paymentFor int, c echo.Context) error {
+func (h *WebhookHandler) createInvoiceForMekariSign(ctx context.Context, t *config.Tenant, signer interface{}, dataID string, paymentFor int) (res webhookResponse) {
+	ctx, span := tracing.Start(ctx, "createInvoiceForMekariSign", attribute.Int("payment_for", paymentFor))
+	defer func() { endSpan(span, res.status) }()
 
 	// data dump for signer
-	logger.NewLogger().Info("createInvoiceForMekariSign", zap.Any("signer", signer))
-	logger.NewLogger().Info("createInvoiceForMekariSign", zap.String("dataID", dataID))
-	logger.NewLogger().Info("createInvoiceForMekariSign", zap.Int("paymentFor", paymentFor))
+	logger.FromContext(ctx).Info("createInvoiceForMekariSign", zap.Any("signer", signer))
+	logger.FromContext(ctx).Info("createInvoiceForMekariSign", zap.String("dataID", dataID))
+	logger.FromContext(ctx).Info("createInvoiceForMekariSign", zap.Int("paymentFor", paymentFor))
 
 	var payerPhone string
 	signerData, dataExists := signer.(map[string]interface{})
@@ -242,38 +321,23 @@ func (h *WebhookHandler) createInvoiceForMekariSign(signer interface{}, dataID s
 	payerName, nameExists := signerData["name"].(string)
 	payerPhone, phoneExists := signerData["phone"].(string)
 
-	// logger.NewLogger().Info("createInvoiceForMekariSign", zap.String("payerEmail", payerEmail))
-	// logger.NewLogger().Info("createInvoiceForMekariSign", zap.String("payerName", payerName))
-	// logger.NewLogger().Info("createInvoiceForMekariSign", zap.String("payerPhone", payerPhone))
-	// logger.NewLogger().Info("createInvoiceForMekariSign", zap.Bool("payerPhone exist", phoneExists))
-
 	if !dataExists {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Signer data is missing"})
+		return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Signer data is missing"}}
 	}
 	if phoneExists && payerPhone != "" {
-		logger.NewLogger().Info("createInvoiceForMekariSign", zap.String("Sanitizing phone:", payerPhone))
-		// return c.JSON(http.StatusBadRequest, map[string]string{"error": "Phone number is missing"})
-		// Remove + if start with +
-		if payerPhone[0] == '+' {
-			payerPhone = payerPhone[1:]
-		}
-		if payerPhone[:2] == "08" {
-			payerPhone = "628" + payerPhone[2:]
-		}
-
-		payerPhone = fmt.Sprintf("+%s", payerPhone)
-	} else {
-		payerPhone = "+"
+		logger.FromContext(ctx).Info("createInvoiceForMekariSign", zap.String("Sanitizing phone:", payerPhone))
+		// return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Phone number is missing"}}
 	}
+	payerPhone = sanitizePhone(payerPhone)
 	if !nameExists {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name is missing"})
+		return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Name is missing"}}
 	}
 	if !emailExists {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Email is missing"})
+		return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Email is missing"}}
 	}
 
-	externalID := fmt.Sprintf("q%d-goglobal-%s", paymentFor, dataID)
-	logger.NewLogger().Info("Creating invoice for MekariSign webhook", zap.String("external_id", externalID))
+	externalID := buildExternalID(t.ID, paymentFor, dataID, 1)
+	logger.FromContext(ctx).Info("Creating invoice for MekariSign webhook", zap.String("external_id", externalID))
 
 	customer := &service.CustomerObject{
 		Id:           externalID,
@@ -285,55 +349,114 @@ func (h *WebhookHandler) createInvoiceForMekariSign(signer interface{}, dataID s
 		CustomerId:   externalID,
 	}
 
-	logger.NewLogger().Info("Customer object", zap.Any("customer", customer))
+	logger.FromContext(ctx).Info("Customer object", zap.Any("customer", customer))
 
-	description := fmt.Sprintf("Pembayaran ke-%d Go Global Indonesia kepada %s", paymentFor, payerName)
+	description := invoiceDescription(paymentFor, t, payerName, "")
 
-	invDuration := h.cfg.XenditInvDuration
+	settings := h.settings.Get(t)
+	invDuration := settings.InvoiceDuration
 	if paymentFor == 2 {
-		// set expiry date to date 5 april 2025 for second payment
-		// count day from now to 5 april 2025
-		loc, err := time.LoadLocation("Asia/Jakarta")
-		if err != nil {
-			logger.NewLogger().Error("Failed to load location", zap.Error(err))
-		}
+		// pembayaran kedua berlaku sampai batas waktu di settings, default 30 april 2025
+		var expiryDate time.Time
+		if settings.SecondPaymentDeadline != nil {
+			expiryDate = *settings.SecondPaymentDeadline
+		} else {
+			loc, err := time.LoadLocation("Asia/Jakarta")
+			if err != nil {
+				logger.FromContext(ctx).Error("Failed to load location", zap.Error(err))
+			}
 
-		// Set expiry date in Jakarta time
-		expiryDate := time.Date(2025, 4, 30, 23, 59, 0, 0, loc)
+			// Set expiry date in Jakarta time
+			expiryDate = time.Date(2025, 4, 30, 23, 59, 0, 0, loc)
+		}
 		invDuration = fmt.Sprintf("%.0f", time.Until(expiryDate).Seconds())
 	}
 
-	logger.NewLogger().Info("createInvoiceForMekariSign", zap.String("Invoice duration", invDuration))
+	logger.FromContext(ctx).Info("createInvoiceForMekariSign", zap.String("Invoice duration", invDuration))
 
 	// check data from db
-	student, err := model.GetStudentByEmail(payerEmail)
+	student, err := model.GetStudentByEmail(ctx, payerEmail)
 	if student == nil {
-		logger.NewLogger().Error("createInvoiceForMekariSign => Failed to get students", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get students"})
-	}
-
-	// get class data
-	var amount float64
-	if student.ProgramType.Valid { // Pastikan ProgramType tidak NULL
-		switch student.ProgramType.String {
-		case "kelas_senin_jumat_siang":
-			amount = 6250000
-		case "kelas_senin_jumat_malam":
-			amount = 6000000
-		case "kelas_akhir_pekan":
-			amount = 6000000
-		default:
-			amount = 7500000 // Atur default jika tidak cocok
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "ProgramType is NULL"})
+		logger.FromContext(ctx).Error("createInvoiceForMekariSign => Failed to get students", zap.Error(err))
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to get students"}}
+	}
+
+	// hitung harga program beserta potongan yang berlaku
+	// pembayaran kedua memakai aturan harga yang berlaku saat pembayaran pertama dihitung
+	var quotedAt time.Time
+	if paymentFor == 2 {
+		quotedAt = h.firstInstallmentQuoteTime(ctx, dataID)
+	}
+	quote, err := h.pricing.Quote(ctx, service.PricingInput{
+		TenantID:   t.ID,
+		Student:    student,
+		PaymentFor: paymentFor,
+		Now:        quotedAt,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("createInvoiceForMekariSign => Failed to quote price", zap.Error(err))
+		if errors.Is(err, service.ErrUnknownProgram) {
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to get program type"}}
 		}
-	} else {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get program type"})
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to calculate price"}}
+	}
+	amount := quote.Total
+	program, _ := h.pricing.Program(quote.ProgramType)
+
+	logger.FromContext(ctx).Info("Amount", zap.Float64("amount", amount), zap.Any("adjustments", quote.Adjustments))
+	logger.FromContext(ctx).Info("Student", zap.Any("student", student))
+
+	entry := service.LedgerEntry{
+		TenantID:    t.ID,
+		ExternalID:  externalID,
+		DocumentID:  dataID,
+		PaymentFor:  paymentFor,
+		PayerEmail:  payerEmail,
+		PayerName:   payerName,
+		Description: description,
+		Amount:      amount,
+		Pricing:     quote,
 	}
 
-	logger.NewLogger().Info("Amount", zap.Float64("amount", amount))
-	logger.NewLogger().Info("Student", zap.Any("student", student))
+	// reservasi di ledger dicatat sebelum memanggil Xendit, retry webhook memakai invoice yang sudah ada
+	existing, reserved, err := h.ledger.Reserve(ctx, entry)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to reserve invoice in ledger", zap.Error(err))
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to record invoice"}}
+	}
+	if !reserved {
+		if existing == nil {
+			// reservasi baru saja dilepas request lain yang gagal
+			return webhookResponse{http.StatusConflict, map[string]string{"error": "Invoice creation is in progress"}}
+		}
+		if existing.Status != service.LedgerStatusCreating {
+			return h.reuseInvoice(ctx, t, existing)
+		}
+		takenOver, err := h.ledger.TakeOverReservation(ctx, externalID)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to take over invoice reservation", zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to record invoice"}}
+		}
+		if !takenOver {
+			return webhookResponse{http.StatusConflict, map[string]string{"error": "Invoice creation is in progress"}}
+		}
+		// proses sebelumnya mati di tengah jalan, bisa jadi invoice sudah terlanjur dibuat di Xendit
+		inv, err := h.xendit[t.ID].FindInvoiceByExternalID(ctx, externalID)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to look up invoice", zap.String("external_id", externalID), zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to look up invoice"}}
+		}
+		if inv != nil {
+			logger.FromContext(ctx).Info("Adopting invoice created before crash", zap.String("external_id", externalID))
+			entry.InvoiceID = *inv.Id
+			entry.InvoiceURL = inv.InvoiceUrl
+			entry.Status = string(inv.Status)
+			return h.completeInvoice(ctx, t, entry)
+		}
+	}
 
-	invoice, err := h.xs.CreateInvoice(
+	invoice, err := h.xendit[t.ID].CreateInvoice(
+		ctx,
 		externalID,
 		payerEmail,
 		description,
@@ -341,62 +464,145 @@ func (h *WebhookHandler) createInvoiceForMekariSign(signer interface{}, dataID s
 		invDuration,
 		amount,
 		"",
+		quoteInvoiceOptions(quote, program),
 	)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create invoice"})
+		logger.FromContext(ctx).Error("Failed to create invoice", zap.String("external_id", externalID), zap.Error(err))
+		if rerr := h.ledger.Release(ctx, externalID); rerr != nil {
+			logger.FromContext(ctx).Error("Failed to release invoice reservation", zap.Error(rerr))
+		}
+		h.notifyProcessingFailed(ctx, t, externalID, description, payerName, payerEmail, err)
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to create invoice"}}
 	}
 
 	invoiceJSON, err := json.Marshal(invoice)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to marshal invoice"})
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to marshal invoice"}}
 	}
 
 	var invoiceResponse InvoiceData
 	if err := json.Unmarshal(invoiceJSON, &invoiceResponse); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to parse invoice response"})
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to parse invoice response"}}
+	}
+
+	logger.FromContext(ctx).Info("Invoice created", zap.Any("invoice", invoiceResponse))
+
+	entry.InvoiceID = invoiceResponse.ID
+	entry.InvoiceURL = invoiceResponse.InvoiceURL
+	entry.Status = invoiceResponse.Status
+	return h.completeInvoice(ctx, t, entry)
+}
+
+// completeInvoice melengkapi entry ledger dengan data invoice lalu mencatat email invoice ke outbox.
+// Jika salah satunya gagal, retry webhook akan melanjutkan lewat reuseInvoice tanpa membuat invoice baru.
+func (h *WebhookHandler) completeInvoice(ctx context.Context, t *config.Tenant, entry service.LedgerEntry) webhookResponse {
+	if err := h.ledger.RecordInvoice(ctx, entry); err != nil {
+		logger.FromContext(ctx).Error("Failed to record invoice in ledger", zap.Error(err))
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to record invoice"}}
+	}
+	if err := h.enqueueInvoiceEmail(ctx, t, entry); err != nil {
+		logger.FromContext(ctx).Error("Failed to enqueue invoice email", zap.Error(err))
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to send email"}}
 	}
 
-	logger.NewLogger().Info("Invoice created", zap.Any("invoice", invoiceResponse))
+	return webhookResponse{http.StatusOK, map[string]interface{}{
+		"message":      "Webhook processed and invoice created",
+		"invoice_link": entry.InvoiceURL,
+		"invoice_id":   entry.InvoiceID,
+	}}
+}
 
-	// Publish invoice to RabbitMQ
-	emailData := service.EmailSendStruct{
-		To:            payerEmail,
-		Subject:       description,
-		RecipientName: payerName,
-		Link:          invoiceResponse.InvoiceURL,
-		DueDate:       "beberapa hari kedepan",
+// reuseInvoice menangani webhook yang dikirim ulang untuk invoice yang sudah dibuat: email invoice dicatat
+// ulang (outbox mengabaikan key yang sudah ada) dan link invoice lama dikembalikan
+func (h *WebhookHandler) reuseInvoice(ctx context.Context, t *config.Tenant, entry *service.LedgerEntry) webhookResponse {
+	if entry.ReplacedBy != "" {
+		return webhookResponse{http.StatusOK, map[string]string{"message": "Invoice has been replaced", "replaced_by": entry.ReplacedBy}}
 	}
 
-	if paymentFor == 1 {
-		templateName := "template_send_email_sign_success.html"
-		err = h.rabbitMQ.SendEmail(emailData.To, emailData.Subject, templateName, emailData)
+	// entry lama belum menyimpan link invoice
+	if entry.InvoiceURL == "" && entry.InvoiceID != "" {
+		inv, err := h.xendit[t.ID].GetInvoice(ctx, entry.InvoiceID)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send email"})
+			logger.FromContext(ctx).Error("Failed to get existing invoice", zap.String("invoice_id", entry.InvoiceID), zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to get existing invoice"}}
 		}
-	} else if paymentFor == 2 {
-		templateName := "template_send_email_payment_1_success.html"
-		err = h.rabbitMQ.SendEmail(emailData.To, emailData.Subject, templateName, emailData)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send email"})
+		entry.InvoiceURL = inv.InvoiceUrl
+		if err := h.ledger.RecordInvoice(ctx, *entry); err != nil {
+			logger.FromContext(ctx).Error("Failed to record invoice in ledger", zap.Error(err))
 		}
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message":      "Webhook processed and invoice created",
-		"invoice_link": invoiceResponse.InvoiceURL,
-		"invoice_id":   invoiceResponse.ID,
+	logger.FromContext(ctx).Info("Invoice already exists, reusing", zap.String("external_id", entry.ExternalID))
+	if err := h.enqueueInvoiceEmail(ctx, t, *entry); err != nil {
+		logger.FromContext(ctx).Error("Failed to enqueue invoice email", zap.Error(err))
+		return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to send email"}}
+	}
+	return webhookResponse{http.StatusOK, map[string]interface{}{
+		"message":      "Webhook processed, invoice already exists",
+		"invoice_link": entry.InvoiceURL,
+		"invoice_id":   entry.InvoiceID,
+	}}
+}
+
+// enqueueInvoiceEmail mencatat email invoice ke outbox. Key notifikasi adalah external ID sehingga
+// pemanggilan berulang (retry webhook atau rekonsiliasi) tidak mengirim email ganda.
+func (h *WebhookHandler) enqueueInvoiceEmail(ctx context.Context, t *config.Tenant, entry service.LedgerEntry) error {
+	var templateName string
+	if entry.PaymentFor == 1 {
+		templateName = "template_send_email_sign_success.html"
+	} else if entry.PaymentFor == 2 {
+		templateName = "template_send_email_payment_1_success.html"
+	}
+	if templateName == "" || entry.InvoiceURL == "" {
+		return nil
+	}
+
+	emailData := service.TemplateData{
+		"To":            entry.PayerEmail,
+		"Subject":       entry.Description,
+		"RecipientName": entry.PayerName,
+		"Link":          entry.InvoiceURL,
+		"DueDate":       "beberapa hari kedepan",
+	}
+	payload, err := h.templates.BuildEmail(t, entry.PayerEmail, entry.Description, templateName, emailData)
+	if err != nil {
+		return err
+	}
+	return h.notifications.Notify(ctx, service.Notification{
+		Key:       entry.ExternalID,
+		Event:     config.EventInvoiceIssued,
+		Type:      service.MessageInvoiceIssued,
+		TenantID:  t.ID,
+		Recipient: service.Recipient{Role: config.RoleStudent, Name: entry.PayerName, Email: entry.PayerEmail},
+		Email:     &payload,
 	})
 }
 
-func (h *WebhookHandler) handleXenditWebhook(req map[string]interface{}, c echo.Context) error {
-	logger.NewLogger().Info("Xendit webhook received", zap.Any("request", req))
+func (h *WebhookHandler) processXenditCallback(ctx context.Context, t *config.Tenant, req map[string]interface{}) (res webhookResponse) {
+	ctx, span := tracing.Start(ctx, "processXenditCallback", attribute.String("tenant", t.ID))
+	defer func() { endSpan(span, res.status) }()
+
+	logger.FromContext(ctx).Info("Xendit webhook received", zap.Any("request", req))
 	xenditDesc, ok := req["description"].(string)
 	if !ok {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid description"})
+		return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Invalid description"}}
 	}
 	xenditStatus, ok := req["status"].(string)
 	if !ok {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid status"})
+		return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Invalid status"}}
+	}
+	externalID, _ := req["external_id"].(string)
+	settings := h.settings.Get(t)
+
+	// abaikan callback untuk invoice yang sudah diganti lewat endpoint admin
+	if entry, err := h.ledger.FindByExternalID(ctx, externalID); err == nil && entry != nil && entry.ReplacedBy != "" {
+		logger.FromContext(ctx).Info("Ignoring callback for replaced invoice",
+			zap.String("external_id", externalID), zap.String("replaced_by", entry.ReplacedBy))
+		return webhookResponse{http.StatusOK, map[string]string{"message": "Webhook ignored, invoice has been replaced"}}
+	}
+
+	if err := h.ledger.MarkStatus(ctx, externalID, xenditStatus); err != nil {
+		logger.FromContext(ctx).Error("Failed to update ledger status", zap.Error(err))
 	}
 
 	// jika xenditDesc mengandung kata "Pembayaran ke-1" dan xenditStatus adalah "PAID" maka akan di proses pembuatan invoice baru dengan nama Pembayaran ke-2
@@ -405,86 +611,80 @@ func (h *WebhookHandler) handleXenditWebhook(req map[string]interface{}, c echo.
 		payerNotificationEmail, _ := req["payer_email"].(string)
 		payerNotificationDesc, _ := req["description"].(string)
 		payerNotificationInvoice, _ := req["id"].(string)
-		payerNotificationName := req["description"].(string)[43:]
+		payerNotificationName := payerNameFromDescription(xenditDesc)
 
-		emailNotificationData := service.PaymentNotificationStruct{
-			To:            payerNotificationEmail,
-			Subject:       payerNotificationDesc,
-			RecipientName: payerNotificationName,
-			InvoiceID:     "https://checkout.xendit.co/web/" + payerNotificationInvoice,
-			Amount:        fmt.Sprintf("Rp %s", humanize.Comma(int64(req["amount"].(float64)))),
-		}
+		paidAmount, _ := req["amount"].(float64)
+		staffPayment := h.paymentStaffEvent(ctx, t, externalID, payerNotificationName, payerNotificationEmail, payerNotificationDesc,
+			"https://checkout.xendit.co/web/"+payerNotificationInvoice, paidAmount)
 
-		err := h.rabbitMQ.SendPaymentNotification("aliffirdi07@gmail.com", "Pendaftaran LPK Go Global", "template_send_email_success_payment.html", emailNotificationData)
-		if err != nil {
-			logger.NewLogger().Error("Failed to send email", zap.Error(err))
-			// return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send email"})
+		// sanitize "q1-<tenant>-<data_id>[-v<versi>]" menjadi "<data_id>"
+		parts, ok := parseExternalID(externalID)
+		if !ok {
+			return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Invalid external_id"}}
 		}
+		dataID := parts.DataID
 
-		// sanitize "q1-goglobal-<data_id>" menjadi "<data_id>"
-		dataID := req["external_id"].(string)[12:]
-
-		logger.NewLogger().Info("Creating invoice for Xendit webhook", zap.String("external_id", dataID))
+		logger.FromContext(ctx).Info("Creating invoice for Xendit webhook", zap.String("external_id", dataID))
 
 		// Get data from 'webhook_mekarisign' collection
 		mekariSignCollection := h.db.DB.Collection("webhook_mekarisign")
-		if err := mekariSignCollection.FindOne(context.Background(), bson.M{"data.id": dataID}).Decode(&mekariSignData); err != nil {
-			logger.NewLogger().Error("Failed to get data from MekariSign collection", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get data from MekariSign collection"})
+		if err := mekariSignCollection.FindOne(ctx, bson.M{"data.id": dataID}).Decode(&mekariSignData); err != nil {
+			logger.FromContext(ctx).Error("Failed to get data from MekariSign collection", zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to get data from MekariSign collection"}}
 		}
 
-		signers := mekariSignData.Data.Attributes.Signers
-
-		// Filter out Email "angga@go-global.id"
-		filteredSigners := []Signer{}
-		for _, signer := range signers {
-			if signer.Email != h.cfg.DirectorMail {
-				filteredSigners = append(filteredSigners, signer)
-			}
+		signer, ok := studentSigner(t, mekariSignData.Data.Attributes.Signers)
+		if !ok {
+			logger.FromContext(ctx).Error("MekariSign document has no student signer", zap.String("data_id", dataID))
+			return webhookResponse{http.StatusUnprocessableEntity, map[string]string{"error": "No student signer found for document"}}
 		}
 
-		logger.NewLogger().Info("Filtered signers", zap.Any("signers", filteredSigners))
-
 		// return for debug purpose
-		// return c.JSON(http.StatusOK, map[string]interface{}{
+		// return webhookResponse{http.StatusOK, map[string]interface{}{
 		// 	"message": "Webhook processed and invoice created",
 		// 	"signers": b,
-		// })
+		// }}
 
-		// convert filteredSigners[0] to map[string]interface{}
-		// filteredSigners[0] is a struct, so we need to convert it to map[string]interface{}
+		// signer is a struct, so we need to convert it to map[string]interface{}
 		// to be able to pass it to createInvoiceForMekariSign
-		signerJSON, err := json.Marshal(filteredSigners[0])
+		signerJSON, err := json.Marshal(signer)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to marshal signer"})
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to marshal signer"}}
 		}
 
 		var signerMap map[string]interface{}
 		if err := json.Unmarshal(signerJSON, &signerMap); err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to parse signer"})
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to parse signer"}}
 		}
 
-		payerPhone := signerMap["phone"].(string)
+		payerPhone := sanitizePhone(signer.Phone)
 
 		// Send wa notification
 		whatsappPayload := service.WhatsAppPayload{
-			Sender:          "WKWK JAPANESE",
-			Recipient:       h.cfg.WhatsappNotificationNumber,
+			Sender:          t.WhatsappSender,
+			Recipient:       settings.WhatsappNotificationNumber,
 			RecipientName:   payerNotificationName,
-			TemplateID:      "194cd576-8d34-4f5f-b9ca-29e97d1bbe90",
-			Attrb:           []string{"Pembayaran Kedua", "Program Basic Kelas A", "Batch 1.0", fmt.Sprintf("Rp %s", humanize.Comma(int64(req["amount"].(float64)))), payerNotificationName, payerNotificationEmail, payerPhone, payerNotificationInvoice},
+			TemplateID:      settings.WhatsappTemplateID,
+			Attrb:           []string{"Pembayaran Kedua", "Program Basic Kelas A", "Batch 1.0", service.FormatRupiah(paidAmount), payerNotificationName, payerNotificationEmail, payerPhone, payerNotificationInvoice},
 			EnabledSchedule: 0,
 		}
 
-		err = service.SendWhatsAppMessage(h.cfg, whatsappPayload)
-		if err != nil {
-			logger.NewLogger().Error("Failed to send WhatsApp message", zap.Error(err))
+		// kuitansi siswa dan notifikasi staf dicatat di outbox sebelum invoice berikutnya dibuat
+		receipt := h.paymentReceipt(ctx, t, req, externalID, payerNotificationName)
+		staffPayment.WhatsApp = &whatsappPayload
+		if err := h.staff.Notify(ctx, staffPayment, receipt...); err != nil {
+			logger.FromContext(ctx).Error("Failed to enqueue payment notifications", zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to queue notifications"}}
 		}
 
-		// create invoice for filteredSigners[0]
-		logger.NewLogger().Info("Creating invoice for filtered signer", zap.Any("signer", signerMap))
+		// create invoice for the student signer
+		logger.FromContext(ctx).Info("Creating invoice for filtered signer", zap.Any("signer", signerMap))
 
-		return h.createInvoiceForMekariSign(signerMap, dataID, 2, c)
+		res = h.createInvoiceForMekariSign(ctx, t, signerMap, dataID, 2)
+		if res.status == http.StatusOK {
+			h.markCallbackProcessed(ctx, externalID, xenditStatus)
+		}
+		return res
 	}
 
 	// jika xenditDesc mengandung kata "Pembayaran ke-2" dan xenditStatus adalah "PAID" maka akan di proses pembuatan invoice baru dengan nama Pembayaran ke-2
@@ -493,84 +693,250 @@ func (h *WebhookHandler) handleXenditWebhook(req map[string]interface{}, c echo.
 		payerNotificationEmail, _ := req["payer_email"].(string)
 		payerNotificationDesc, _ := req["description"].(string)
 		payerNotificationInvoice, _ := req["id"].(string)
-		payerNotificationName := req["description"].(string)[43:]
+		payerNotificationName := payerNameFromDescription(xenditDesc)
 
-		emailNotificationData := service.PaymentNotificationStruct{
-			To:            payerNotificationEmail,
-			Subject:       payerNotificationDesc,
-			RecipientName: payerNotificationName,
-			InvoiceID:     "https://checkout.xendit.co/web/" + payerNotificationInvoice,
-			Amount:        fmt.Sprintf("Rp %s", humanize.Comma(int64(req["amount"].(float64)))),
-		}
+		paidAmount, _ := req["amount"].(float64)
+		staffPayment := h.paymentStaffEvent(ctx, t, externalID, payerNotificationName, payerNotificationEmail, payerNotificationDesc,
+			"https://checkout.xendit.co/web/"+payerNotificationInvoice, paidAmount)
 
-		err := h.rabbitMQ.SendPaymentNotification("aliffirdi07@gmail.com", "Pendaftaran LPK Go Global", "template_send_email_success_payment.html", emailNotificationData)
-		if err != nil {
-			logger.NewLogger().Error("Failed to send email", zap.Error(err))
-			// return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send email"})
+		// sanitize "q1-<tenant>-<data_id>[-v<versi>]" menjadi "<data_id>"
+		parts, ok := parseExternalID(externalID)
+		if !ok {
+			return webhookResponse{http.StatusBadRequest, map[string]string{"error": "Invalid external_id"}}
 		}
+		dataID := parts.DataID
 
-		// sanitize "q1-goglobal-<data_id>" menjadi "<data_id>"
-		dataID := req["external_id"].(string)[12:]
-
-		logger.NewLogger().Info("Creating invoice for Xendit webhook", zap.String("external_id", dataID))
+		logger.FromContext(ctx).Info("Creating invoice for Xendit webhook", zap.String("external_id", dataID))
 
 		// Get data from 'webhook_mekarisign' collection
 		mekariSignCollection := h.db.DB.Collection("webhook_mekarisign")
-		if err := mekariSignCollection.FindOne(context.Background(), bson.M{"data.id": dataID}).Decode(&mekariSignData); err != nil {
-			logger.NewLogger().Error("Failed to get data from MekariSign collection", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get data from MekariSign collection"})
+		if err := mekariSignCollection.FindOne(ctx, bson.M{"data.id": dataID}).Decode(&mekariSignData); err != nil {
+			logger.FromContext(ctx).Error("Failed to get data from MekariSign collection", zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to get data from MekariSign collection"}}
 		}
 
-		signers := mekariSignData.Data.Attributes.Signers
-
-		// Filter out Email "angga@go-global.id"
-		filteredSigners := []Signer{}
-		for _, signer := range signers {
-			if signer.Email != h.cfg.DirectorMail {
-				filteredSigners = append(filteredSigners, signer)
-			}
+		signer, ok := studentSigner(t, mekariSignData.Data.Attributes.Signers)
+		if !ok {
+			logger.FromContext(ctx).Error("MekariSign document has no student signer", zap.String("data_id", dataID))
+			return webhookResponse{http.StatusUnprocessableEntity, map[string]string{"error": "No student signer found for document"}}
 		}
 
-		logger.NewLogger().Info("Filtered signers", zap.Any("signers", filteredSigners))
-
-		payerEmail := filteredSigners[0].Email
-		payerName := filteredSigners[0].Name
-		payerPhone := filteredSigners[0].Phone
+		payerEmail := signer.Email
+		payerName := signer.Name
+		payerPhone := sanitizePhone(signer.Phone)
 
-		if payerPhone[0] == '+' {
-			payerPhone = payerPhone[1:]
+		emailData := service.TemplateData{
+			"To":            payerEmail,
+			"Subject":       "Pembayaran ke-2 Telah Lunas",
+			"RecipientName": payerName,
 		}
-		if payerPhone[:2] == "08" {
-			payerPhone = "628" + payerPhone[2:]
-		}
-
-		emailData := service.EmailSendStruct{
-			To:            payerEmail,
-			Subject:       "Pembayaran ke-2 Telah Lunas",
-			RecipientName: payerName,
-			Link:          "",
-			DueDate:       "beberapa hari kedepan",
-		}
-		templateName := "template_send_email_payment_2_success.html"
-		err = h.rabbitMQ.SendEmail(emailData.To, emailData.Subject, templateName, emailData)
+		studentEmail, err := h.templates.BuildEmail(t, payerEmail, "Pembayaran ke-2 Telah Lunas", "template_send_email_payment_2_success.html", emailData)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send email"})
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to render email"}}
 		}
 		// Send wa notification
 		whatsappPayload := service.WhatsAppPayload{
-			Sender:          "WKWK JAPANESE",
-			Recipient:       h.cfg.WhatsappNotificationNumber,
+			Sender:          t.WhatsappSender,
+			Recipient:       settings.WhatsappNotificationNumber,
 			RecipientName:   payerName,
-			TemplateID:      "194cd576-8d34-4f5f-b9ca-29e97d1bbe90",
-			Attrb:           []string{"Pembayaran Kedua", "Program Basic Kelas A", "Batch 1.0", fmt.Sprintf("Rp %s", humanize.Comma(int64(req["amount"].(float64)))), payerNotificationName, payerNotificationEmail, payerPhone, payerNotificationInvoice},
+			TemplateID:      settings.WhatsappTemplateID,
+			Attrb:           []string{"Pembayaran Kedua", "Program Basic Kelas A", "Batch 1.0", service.FormatRupiah(paidAmount), payerNotificationName, payerNotificationEmail, payerPhone, payerNotificationInvoice},
 			EnabledSchedule: 0,
 		}
 
-		err = service.SendWhatsAppMessage(h.cfg, whatsappPayload)
-		if err != nil {
-			logger.NewLogger().Error("Failed to send WhatsApp message", zap.Error(err))
+		student := service.Notification{
+			Key:       externalID,
+			Event:     config.EventPaymentReceived,
+			Type:      service.MessagePaymentCompleted,
+			TenantID:  t.ID,
+			Recipient: service.Recipient{Role: config.RoleStudent, Name: payerName, Email: payerEmail, Phone: payerPhone},
+			Email:     &studentEmail,
 		}
+		staffPayment.WhatsApp = &whatsappPayload
+		if err := h.staff.Notify(ctx, staffPayment, student); err != nil {
+			logger.FromContext(ctx).Error("Failed to enqueue payment notifications", zap.Error(err))
+			return webhookResponse{http.StatusInternalServerError, map[string]string{"error": "Failed to queue notifications"}}
+		}
+
+		h.markCallbackProcessed(ctx, externalID, xenditStatus)
+		return webhookResponse{http.StatusOK, map[string]string{"message": "Webhook received"}}
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook received"})
+	// callback lunas yang tidak perlu diproses lanjut (misalnya invoice dari POST /invoice) langsung dianggap selesai,
+	// callback pembayaran ke-1/ke-2 hanya ditandai selesai oleh cabang di atas agar rekonsiliasi bisa mengulanginya
+	installment := strings.Contains(xenditDesc, "Pembayaran ke-1") || strings.Contains(xenditDesc, "Pembayaran ke-2")
+	if isPaidStatus(xenditStatus) && !installment {
+		h.markCallbackProcessed(ctx, externalID, xenditStatus)
+	}
+
+	return webhookResponse{http.StatusOK, map[string]string{"message": "Webhook received"}}
+}
+
+// studentSigner mengambil penanda tangan pertama yang bukan direktur tenant, yaitu siswa yang membayar
+func studentSigner(t *config.Tenant, signers []Signer) (Signer, bool) {
+	for _, signer := range signers {
+		if !t.IsDirector(signer.Email) {
+			return signer, true
+		}
+	}
+	return Signer{}, false
+}
+
+func (h *WebhookHandler) markCallbackProcessed(ctx context.Context, externalID string, status string) {
+	if err := h.ledger.MarkProcessed(ctx, externalID, status); err != nil {
+		logger.FromContext(ctx).Error("Failed to mark callback as processed", zap.Error(err))
+	}
+}
+
+// invoiceDescription menyusun deskripsi invoice "Pembayaran ke-N <tenant> kepada <nama>". processXenditCallback
+// mengenali pembayaran dari awal deskripsi, sehingga catatan tambahan hanya boleh ditulis di akhir dalam kurung.
+func invoiceDescription(paymentFor int, t *config.Tenant, payerName, note string) string {
+	description := fmt.Sprintf("Pembayaran ke-%d %s kepada %s", paymentFor, t.Name, payerName)
+	if note = strings.TrimSpace(note); note != "" {
+		description += " (" + note + ")"
+	}
+	return description
+}
+
+// payerNameFromDescription mengambil nama pembayar dari deskripsi invoiceDescription, tanpa catatan di akhir
+func payerNameFromDescription(description string) string {
+	if i := strings.LastIndex(description, " kepada "); i >= 0 {
+		name := description[i+len(" kepada "):]
+		if j := strings.LastIndex(name, " ("); j >= 0 && strings.HasSuffix(name, ")") {
+			name = name[:j]
+		}
+		return name
+	}
+	return description
+}
+
+// notifyProcessingFailed memberi tahu staf bahwa webhook gagal diproses dan perlu ditindaklanjuti
+func (h *WebhookHandler) notifyProcessingFailed(ctx context.Context, t *config.Tenant, key, description, name, email string, cause error) {
+	err := h.staff.Notify(ctx, service.StaffEvent{
+		Key:    key,
+		Event:  config.EventProcessingFailed,
+		Tenant: t,
+		Item: service.StaffDigestItem{
+			Description: description,
+			Name:        name,
+			Email:       email,
+			Error:       logger.MaskPII(cause.Error()),
+			OccurredAt:  time.Now(),
+		},
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to enqueue processing failed notification", zap.Error(err))
+	}
+}
+
+// firstInstallmentQuoteTime mengambil waktu perhitungan harga invoice pembayaran pertama dokumen dari ledger,
+// agar promo yang berakhir di antara kedua pembayaran tidak mengubah tagihan kedua. Nilai nol berarti waktu sekarang.
+func (h *WebhookHandler) firstInstallmentQuoteTime(ctx context.Context, dataID string) time.Time {
+	entries, err := h.ledger.Chain(ctx, dataID, 1)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to read first installment from ledger", zap.String("data_id", dataID), zap.Error(err))
+		return time.Time{}
+	}
+	for _, entry := range entries {
+		if entry.Pricing != nil && !entry.Pricing.QuotedAt.IsZero() {
+			return entry.Pricing.QuotedAt
+		}
+	}
+	return time.Time{}
+}
+
+// paymentReceipt membuat kuitansi PDF untuk pembayaran pada callback Xendit, mencatatnya di lampiran siswa
+// dan menyiapkan email kuitansi. Kegagalan hanya dicatat di log agar invoice berikutnya tetap dibuat.
+func (h *WebhookHandler) paymentReceipt(ctx context.Context, t *config.Tenant, req map[string]interface{}, externalID string, payerName string) []service.Notification {
+	in := service.ReceiptInput{
+		Tenant:     t,
+		ExternalID: externalID,
+		PayerName:  payerName,
+	}
+	in.PayerEmail, _ = req["payer_email"].(string)
+	in.InvoiceID, _ = req["id"].(string)
+	in.Description, _ = req["description"].(string)
+	in.PaymentMethod, _ = req["payment_method"].(string)
+	in.PaymentChannel, _ = req["payment_channel"].(string)
+	if in.Amount, _ = req["paid_amount"].(float64); in.Amount == 0 {
+		in.Amount, _ = req["amount"].(float64)
+	}
+	if paidAt, ok := req["paid_at"].(string); ok {
+		in.PaidAt, _ = time.Parse(time.RFC3339, paidAt)
+	}
+
+	// sisa pembayaran adalah tagihan pembayaran kedua
+	student, err := model.GetStudentByEmail(ctx, in.PayerEmail)
+	if student != nil {
+		var quotedAt time.Time
+		if parts, ok := parseExternalID(externalID); ok {
+			quotedAt = h.firstInstallmentQuoteTime(ctx, parts.DataID)
+		}
+		quote, err := h.pricing.Quote(ctx, service.PricingInput{TenantID: t.ID, Student: student, PaymentFor: 2, Now: quotedAt})
+		if err == nil {
+			in.RemainingBalance = &quote.Total
+		} else {
+			logger.FromContext(ctx).Warn("Failed to calculate remaining balance for receipt", zap.Error(err))
+		}
+	} else {
+		logger.FromContext(ctx).Warn("paymentReceipt => Failed to get students", zap.Error(err))
+	}
+
+	receipt, err := h.receipts.Issue(ctx, in)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to issue receipt", zap.Error(err))
+		return nil
+	}
+	if student != nil {
+		if err := h.receipts.AttachToStudent(ctx, receipt, student.ID); err != nil {
+			logger.FromContext(ctx).Error("Failed to save receipt as student attachment", zap.Error(err))
+		}
+	}
+
+	email, err := h.receipts.ReceiptEmail(t, receipt)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to render receipt email", zap.Error(err))
+		return nil
+	}
+	logger.FromContext(ctx).Info("Receipt issued", zap.String("number", receipt.Number))
+	return []service.Notification{{
+		Key:       externalID,
+		Event:     config.EventPaymentReceived,
+		Type:      service.MessagePaymentReceipt,
+		TenantID:  t.ID,
+		Recipient: service.Recipient{Role: config.RoleStudent, Name: payerName, Email: in.PayerEmail},
+		Email:     &email,
+	}}
+}
+
+// paymentStaffEvent menyiapkan notifikasi pembayaran untuk staf. Email ringkasan pembayaran memakai
+// template tenant, jika gagal dirender email dibuat dari template staf umum.
+func (h *WebhookHandler) paymentStaffEvent(ctx context.Context, t *config.Tenant, externalID, payerName, payerEmail, description, invoiceURL string, amount float64) service.StaffEvent {
+	e := service.StaffEvent{
+		Key:    externalID,
+		Event:  config.EventPaymentReceived,
+		Type:   service.MessagePaymentSuccess,
+		Tenant: t,
+		Item: service.StaffDigestItem{
+			Description: description,
+			Name:        payerName,
+			Email:       payerEmail,
+			Amount:      service.FormatRupiah(amount),
+			Link:        invoiceURL,
+			OccurredAt:  time.Now(),
+		},
+	}
+	email, err := h.templates.BuildEmail(t, "", fmt.Sprintf("Pendaftaran LPK %s", t.Name), "template_send_email_success_payment.html", service.TemplateData{
+		"To":            payerEmail,
+		"Subject":       description,
+		"RecipientName": payerName,
+		"InvoiceID":     invoiceURL,
+		"Amount":        amount,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to render payment notification", zap.Error(err))
+	} else {
+		e.Email = &email
+	}
+	return e
 }
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"webhook-listener-mekarisign/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSanitizePhone(t *testing.T) {
+	tests := map[string]string{
+		"081234567890":   "+6281234567890",
+		"6281234567890":  "+6281234567890",
+		"+6281234567890": "+6281234567890",
+		" 081234567890 ": "+6281234567890",
+		"":               "",
+		"+":              "",
+		"0":              "+0",
+	}
+	for in, want := range tests {
+		if got := sanitizePhone(in); got != want {
+			t.Errorf("sanitizePhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStudentSigner(t *testing.T) {
+	tenant := &config.Tenant{ID: "goglobal", DirectorEmails: []string{"direktur@go-global.id"}}
+	director := Signer{Email: "direktur@go-global.id", Name: "Direktur"}
+	student := Signer{Email: "budi@example.com", Name: "Budi", Phone: "0812"}
+
+	if _, ok := studentSigner(tenant, nil); ok {
+		t.Error("no signers should not yield a student")
+	}
+	if _, ok := studentSigner(tenant, []Signer{director}); ok {
+		t.Error("director-only document should not yield a student")
+	}
+	if got, ok := studentSigner(tenant, []Signer{director, student}); !ok || got != student {
+		t.Errorf("studentSigner = %+v, %v, want %+v", got, ok, student)
+	}
+}
+
+func TestHandleWebhookTenantRouting(t *testing.T) {
+	const lpkInvoice = `{"external_id":"q1-lpk_b-doc1","status":"PAID","description":"Pembayaran ke-1 LPK B kepada Budi"}`
+
+	tests := []struct {
+		name     string
+		target   string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{"unknown tenant in path", "/webhook/lpk_x", "token-goglobal", lpkInvoice, http.StatusNotFound},
+		{"missing token", "/webhook/lpk_b", "", lpkInvoice, http.StatusUnauthorized},
+		{"token of another tenant", "/webhook/lpk_b", "token-goglobal", lpkInvoice, http.StatusUnauthorized},
+		{"legacy path routes by external id", "/webhook", "token-goglobal", lpkInvoice, http.StatusUnauthorized},
+		{"path tenant wins over external id", "/webhook/goglobal", "token-lpk-b", lpkInvoice, http.StatusUnauthorized},
+	}
+
+	h := &WebhookHandler{cfg: testConfig}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := "/webhook/:tenant"
+			if tt.target == "/webhook" {
+				route = "/webhook"
+			}
+			code, resp := callHandler(t, http.MethodPost, route, tt.target, h.HandleWebhook, tt.body, withHeader("x-callback-token", tt.token))
+			if code != tt.wantCode {
+				t.Errorf("status = %d, want %d (%v)", code, tt.wantCode, resp)
+			}
+		})
+	}
+}
+
+func TestResolveTenant(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  string
+		target string
+		body   string
+		want   string
+	}{
+		{"path parameter", "/webhook/:tenant", "/webhook/lpk_b", `{}`, "lpk_b"},
+		{"unknown path parameter", "/webhook/:tenant", "/webhook/lpk_x", `{"external_id":"q1-lpk_b-doc1"}`, ""},
+		{"external id", "/webhook", "/webhook", `{"external_id":"q1-lpk_b-doc1-v2"}`, "lpk_b"},
+		{"external id of unknown tenant falls back to default", "/webhook", "/webhook", `{"external_id":"q1-lpk_x-doc1"}`, "goglobal"},
+		{"mekarisign payload uses default", "/webhook", "/webhook", `{"data":{"id":"doc1"}}`, "goglobal"},
+	}
+
+	h := &WebhookHandler{cfg: testConfig}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := func(c echo.Context) error {
+				var req map[string]interface{}
+				if err := c.Bind(&req); err != nil {
+					return err
+				}
+				id := ""
+				if tenant := h.resolveTenant(c, req); tenant != nil {
+					id = tenant.ID
+				}
+				return c.JSON(http.StatusOK, map[string]string{"tenant": id})
+			}
+			_, resp := callHandler(t, http.MethodPost, tt.route, tt.target, fn, tt.body)
+			if resp["tenant"] != tt.want {
+				t.Errorf("tenant = %v, want %s", resp["tenant"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// CorrelationIDHeader dipakai pada request masuk, request keluar, dan header pesan RabbitMQ
+const CorrelationIDHeader = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+type loggerKey struct{}
+
+// NewCorrelationID membuat ID acak 16 byte dalam format hex
+func NewCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithCorrelationID menyimpan correlation ID di context
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID mengambil correlation ID dari context, string kosong jika tidak ada
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WithLogger menyimpan logger di context, dipakai FromContext pada semua pemanggilan di bawahnya
+func WithLogger(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext mengembalikan logger dari context (atau logger bersama jika tidak ada)
+// dengan field correlation_id dan trace_id dari context
+func FromContext(ctx context.Context) *zap.Logger {
+	l := NewLogger()
+	if ctx != nil {
+		if injected, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok && injected != nil {
+			l = injected
+		}
+	}
+	if id := CorrelationID(ctx); id != "" {
+		l = l.With(zap.String("correlation_id", id))
+	}
+	if ctx != nil {
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			l = l.With(zap.String("trace_id", sc.TraceID().String()))
+		}
+	}
+	return l
+}
+
+// correlationTransport menambahkan header correlation ID ke setiap request keluar
+type correlationTransport struct {
+	next http.RoundTripper
+}
+
+func (t correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := CorrelationID(req.Context()); id != "" && req.Header.Get(CorrelationIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(CorrelationIDHeader, id)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// NewHTTPClient membuat http.Client yang meneruskan correlation ID dari context request
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: correlationTransport{next: http.DefaultTransport},
+	}
+}
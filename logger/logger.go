@@ -1,10 +1,68 @@
 package logger
 
 import (
+	"fmt"
+	"sync"
+
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	mu   sync.RWMutex
+	base *zap.Logger
 )
 
+// New membuat logger dengan level (debug, info, warn, error) dan format (json, console)
+// yang menyaring secret dan PII (lihat redact.go). Logger ini diteruskan ke service lewat constructor.
+func New(level, format string) (*zap.Logger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	var zc zap.Config
+	switch format {
+	case "", "json":
+		zc = zap.NewProductionConfig()
+	case "console":
+		zc = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	zc.Level = zap.NewAtomicLevelAt(lvl)
+
+	return zc.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return NewRedactingCore(core)
+	}))
+}
+
+// Init membuat logger bersama, dipakai kode yang belum menerima logger lewat constructor atau context
+// (koneksi database, model). Sebelum Init dipanggil dipakai logger produksi level info.
+func Init(level, format string) error {
+	l, err := New(level, format)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	base = l
+	mu.Unlock()
+	return nil
+}
+
+// NewLogger mengembalikan logger bersama yang sudah menyaring secret dan PII (lihat redact.go).
+// Service menerima logger lewat constructor, di dalam request gunakan FromContext agar correlation ID ikut tercatat.
 func NewLogger() *zap.Logger {
-	logger, _ := zap.NewProduction()
-	return logger
+	mu.RLock()
+	l := base
+	mu.RUnlock()
+	if l != nil {
+		return l
+	}
+
+	if err := Init("info", "json"); err != nil {
+		return zap.NewNop()
+	}
+	return NewLogger()
 }
@@ -0,0 +1,285 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted menggantikan nilai rahasia di log
+const Redacted = "[REDACTED]"
+
+// maxRedactDepth membatasi kedalaman struct/map yang ditelusuri
+const maxRedactDepth = 12
+
+// Field struct bisa ditandai dengan tag log:
+//
+//	log:"secret" nilai diganti seluruhnya dengan [REDACTED]
+//	log:"pii"    semua teks di dalamnya disamarkan, hanya 4 karakter terakhir yang terlihat
+//
+// Key map/field yang namanya mirip kredensial (password, secret, token, api key, authorization)
+// selalu diganti [REDACTED], dan email, nomor HP, serta NIK di semua teks disamarkan.
+var (
+	sensitiveKeyPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|authorization)`)
+	emailPattern        = regexp.MustCompile(`([A-Za-z0-9._%+\-])[A-Za-z0-9._%+\-]*@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	nikPattern          = regexp.MustCompile(`\b\d{12}(\d{4})\b`)
+	phonePattern        = regexp.MustCompile(`(\+62|\b62|\b0)8\d{4,9}(\d{3})\b`)
+)
+
+// MaskPII menyamarkan email, NIK dan nomor HP di dalam teks
+func MaskPII(s string) string {
+	if s == "" {
+		return s
+	}
+	s = emailPattern.ReplaceAllString(s, "$1***@$2")
+	s = nikPattern.ReplaceAllString(s, "************$1")
+	s = phonePattern.ReplaceAllString(s, "${1}8*****$2")
+	return s
+}
+
+// maskAll menyamarkan seluruh teks kecuali 4 karakter terakhir
+func maskAll(s string) string {
+	if len(s) <= 4 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+}
+
+// IsSensitiveKey bernilai true jika nama field/key berisi kredensial
+func IsSensitiveKey(key string) bool {
+	return sensitiveKeyPattern.MatchString(key)
+}
+
+// Redact mengembalikan salinan v yang aman untuk ditulis ke log. Struct dan map diubah
+// menjadi map[string]interface{} dengan field rahasia dihapus dan PII disamarkan.
+func Redact(v interface{}) interface{} {
+	return redactValue(reflect.ValueOf(v), false, 0)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func redactValue(v reflect.Value, pii bool, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxRedactDepth {
+		return "[TRUNCATED]"
+	}
+
+	// tipe dengan MarshalJSON sendiri (time.Time, ObjectID, model SDK) ditelusuri dari hasil JSON-nya
+	if v.Type().Implements(jsonMarshalerType) && v.Kind() != reflect.Interface {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+			return nil
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprintf("[unmarshalable: %v]", err)
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return string(data)
+		}
+		return redactValue(reflect.ValueOf(generic), pii, depth+1)
+	}
+	if v.Type().Implements(errorType) && v.Kind() != reflect.Interface {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		return maskString(v.Interface().(error).Error(), pii)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), pii, depth+1)
+
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := fieldName(f)
+			if name == "-" {
+				continue
+			}
+			tag := f.Tag.Get("log")
+			if tag == "secret" || IsSensitiveKey(f.Name) || IsSensitiveKey(name) {
+				out[name] = redactedOrEmpty(v.Field(i))
+				continue
+			}
+			out[name] = redactValue(v.Field(i), pii || tag == "pii", depth+1)
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			if IsSensitiveKey(key) {
+				out[key] = redactedOrEmpty(iter.Value())
+				continue
+			}
+			out[key] = redactValue(iter.Value(), pii, depth+1)
+		}
+		return out
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		// []byte dibiarkan apa adanya (biasanya kolom tanggal dari MySQL)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), pii, depth+1)
+		}
+		return out
+
+	case reflect.String:
+		return maskString(v.String(), pii)
+
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return v.Type().String()
+	}
+
+	return v.Interface()
+}
+
+func maskString(s string, pii bool) string {
+	if pii {
+		return maskAll(s)
+	}
+	return MaskPII(s)
+}
+
+// redactedOrEmpty tidak menandai nilai kosong, supaya masih terlihat jika kredensial belum diset
+func redactedOrEmpty(v reflect.Value) interface{} {
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+	if v.Kind() == reflect.Interface && v.Elem().Kind() == reflect.String && v.Elem().String() == "" {
+		return ""
+	}
+	return Redacted
+}
+
+func fieldName(f reflect.StructField) string {
+	if tag := f.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// redactCore membungkus zapcore.Core sehingga semua pesan dan field disaring sebelum ditulis
+type redactCore struct {
+	zapcore.Core
+}
+
+// NewRedactingCore mengembalikan core yang menyaring secret dan PII dari semua output
+func NewRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = MaskPII(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		if IsSensitiveKey(f.Key) && f.Type != zapcore.ErrorType {
+			out[i] = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: Redacted}
+			continue
+		}
+
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = MaskPII(f.String)
+		case zapcore.ByteStringType:
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: MaskPII(string(f.Interface.([]byte)))}
+		case zapcore.StringerType:
+			stringer := f.Interface.(fmt.Stringer)
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: MaskPII(safeString(stringer, stringer.String))}
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: MaskPII(safeString(err, err.Error))}
+			}
+		case zapcore.ObjectMarshalerType:
+			enc := zapcore.NewMapObjectEncoder()
+			obj := f.Interface.(zapcore.ObjectMarshaler)
+			f = redactMarshaled(f.Key, enc.Fields, func() error { return obj.MarshalLogObject(enc) })
+		case zapcore.ArrayMarshalerType:
+			enc := zapcore.NewMapObjectEncoder()
+			arr := f.Interface.(zapcore.ArrayMarshaler)
+			key := f.Key
+			f = redactMarshaled(key, nil, func() error { return enc.AddArray(key, arr) })
+			if f.Type == zapcore.ReflectType {
+				f.Interface = Redact(enc.Fields[key])
+			}
+		case zapcore.ReflectType:
+			f.Interface = Redact(f.Interface)
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// safeString memanggil String/Error tanpa ikut panic. Typed nil (mis. (*T)(nil) sebagai fmt.Stringer)
+// dicetak "<nil>" seperti encoder zap, panic lain dicetak sebagai pesan.
+func safeString(v interface{}, fn func() string) (s string) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "<nil>"
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			s = fmt.Sprintf("<PANIC=%v>", r)
+		}
+	}()
+	return fn()
+}
+
+// redactMarshaled menjalankan MarshalLogObject/MarshalLogArray ke encoder map lalu menyamarkan hasilnya,
+// sehingga zap.Object dan zap.Array melewati aturan yang sama dengan zap.Any
+func redactMarshaled(key string, fields map[string]interface{}, marshal func() error) (f zapcore.Field) {
+	defer func() {
+		if r := recover(); r != nil {
+			f = zapcore.Field{Key: key, Type: zapcore.StringType, String: fmt.Sprintf("<PANIC=%v>", r)}
+		}
+	}()
+	if err := marshal(); err != nil {
+		return zapcore.Field{Key: key, Type: zapcore.StringType, String: MaskPII(fmt.Sprintf("[unmarshalable: %v]", err))}
+	}
+	return zapcore.Field{Key: key, Type: zapcore.ReflectType, Interface: Redact(fields)}
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type nilStringer struct{ name string }
+
+func (s *nilStringer) String() string { return s.name }
+
+type panicStringer struct{}
+
+func (panicStringer) String() string { panic("boom") }
+
+type contact struct {
+	Email string
+	Token string
+}
+
+func (c contact) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("email", c.Email)
+	enc.AddString("token", c.Token)
+	return nil
+}
+
+type phones []string
+
+func (p phones) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, v := range p {
+		enc.AppendString(v)
+	}
+	return nil
+}
+
+func TestRedactCore(t *testing.T) {
+	tests := []struct {
+		name  string
+		field zap.Field
+		want  interface{}
+	}{
+		{"email in string", zap.String("payer", "budi.santoso@example.com"), "b***@example.com"},
+		{"phone in string", zap.String("phone", "+6281234567890"), "+628*****890"},
+		{"sensitive key", zap.String("api_key", "xnd_secret"), Redacted},
+		{"byte string", zap.ByteString("raw", []byte("budi@example.com")), "b***@example.com"},
+		{"error", zap.Error(errors.New("send to budi@example.com failed")), "send to b***@example.com failed"},
+		{"typed nil stringer", zap.Stringer("s", (*nilStringer)(nil)), "<nil>"},
+		{"panicking stringer", zap.Stringer("s", panicStringer{}), "<PANIC=boom>"},
+		{"object marshaler", zap.Object("contact", contact{Email: "budi@example.com", Token: "abc"}),
+			map[string]interface{}{"email": "b***@example.com", "token": Redacted}},
+		{"array marshaler", zap.Array("phones", phones{"081234567890"}),
+			[]interface{}{"08*****890"}},
+		{"reflect", zap.Any("req", map[string]interface{}{"password": "x", "email": "budi@example.com"}),
+			map[string]interface{}{"password": Redacted, "email": "b***@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			zap.New(NewRedactingCore(core)).Info("contact budi@example.com", tt.field)
+
+			entry := logs.All()[0]
+			if entry.Message != "contact b***@example.com" {
+				t.Errorf("message = %q, want masked email", entry.Message)
+			}
+			got := entry.ContextMap()[tt.field.Key]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.field.Key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Nama dependency untuk label external call
+const (
+	Xendit   = "xendit"
+	RabbitMQ = "rabbitmq"
+	WhatsApp = "whatsapp"
+	MySQL    = "mysql"
+	Mongo    = "mongo"
+	SMTP     = "smtp"
+)
+
+var (
+	webhooksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_requests_total",
+		Help: "Jumlah webhook yang diterima per provider dan hasil pemrosesan.",
+	}, []string{"provider", "outcome"})
+
+	webhookDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "webhook_request_duration_seconds",
+		Help:    "Lama pemrosesan webhook per provider dan hasil.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"provider", "outcome"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Lama pemrosesan request HTTP per route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	externalCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "external_call_duration_seconds",
+		Help:    "Lama panggilan ke dependency eksternal (Xendit, RabbitMQ, WhatsApp, MySQL, Mongo, SMTP).",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"dependency", "operation", "outcome"})
+)
+
+// Handler mengembalikan handler HTTP untuk endpoint /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveWebhook mencatat satu webhook beserta hasil berdasarkan status HTTP response
+func ObserveWebhook(provider string, status int, d time.Duration) {
+	outcome := Outcome(status)
+	webhooksTotal.WithLabelValues(provider, outcome).Inc()
+	webhookDuration.WithLabelValues(provider, outcome).Observe(d.Seconds())
+}
+
+// ObserveHTTP mencatat lama request HTTP. route adalah pola route echo, bukan URL asli.
+func ObserveHTTP(method, route string, status int, d time.Duration) {
+	httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// Observe mencatat lama satu panggilan ke dependency eksternal
+func Observe(dependency, operation, outcome string, d time.Duration) {
+	externalCallDuration.WithLabelValues(dependency, operation, outcome).Observe(d.Seconds())
+}
+
+// ObserveCall dipakai dengan defer dan named return error:
+//
+//	defer metrics.ObserveCall(metrics.Xendit, "create_invoice", time.Now(), &err)
+func ObserveCall(dependency, operation string, start time.Time, errp *error) {
+	outcome := "success"
+	if errp != nil && *errp != nil {
+		outcome = "error"
+	}
+	Observe(dependency, operation, outcome, time.Since(start))
+}
+
+// Outcome mengelompokkan status HTTP menjadi label hasil
+func Outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "unauthorized"
+	case status >= 500:
+		return "error"
+	case status >= 400:
+		return "rejected"
+	default:
+		return "success"
+	}
+}
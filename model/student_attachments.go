@@ -1,9 +1,11 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 
 	"errors"
+	"strconv"
 
 	"time"
 
@@ -11,6 +13,10 @@ import (
 
 	"webhook-listener-mekarisign/database"
 	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/metrics"
+	"webhook-listener-mekarisign/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type StudentAttachment struct {
@@ -50,9 +56,9 @@ func GetAllStudentAttachments() ([]StudentAttachment, error) {
 }
 
 // GetStudentAttachmentByID mengambil data lampiran mahasiswa berdasarkan ID dari database
-func GetStudentAttachmentByID(id string) (StudentAttachment, error) {
+func GetStudentAttachmentByID(ctx context.Context, id string) (StudentAttachment, error) {
 	var sa StudentAttachment
-	err := database.DB.QueryRow(`SELECT 
+	err := database.DB.QueryRowContext(ctx, `SELECT 
 		id, student_id, file_name, file_url, uploaded_at, created_at, updated_at, deleted_at 
 		FROM student_attachments WHERE id = ?`, id).Scan(
 		&sa.ID, &sa.StudentID, &sa.FileName, &sa.FileURL, &sa.UploadedAt, &sa.CreatedAt, &sa.UpdatedAt, &sa.DeletedAt,
@@ -90,8 +96,8 @@ func GetStudentAttachmentByStudentID(studentID string) ([]StudentAttachment, err
 }
 
 // CreateStudentAttachment membuat data lampiran mahasiswa baru di database
-func CreateStudentAttachment(sa StudentAttachment) (string, error) {
-	result, err := database.DB.Exec(`INSERT INTO student_attachments 
+func CreateStudentAttachment(ctx context.Context, sa StudentAttachment) (string, error) {
+	result, err := database.DB.ExecContext(ctx, `INSERT INTO student_attachments 
 		(id, student_id, file_name, file_url, uploaded_at, created_at, updated_at, deleted_at) 
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, sa.ID, sa.StudentID, sa.FileName, sa.FileURL, sa.UploadedAt, sa.CreatedAt, sa.UpdatedAt, sa.DeletedAt)
 	if err != nil {
@@ -103,13 +109,13 @@ func CreateStudentAttachment(sa StudentAttachment) (string, error) {
 		return "", err
 	}
 
-	return string(id), nil
+	return strconv.FormatInt(id, 10), nil
 }
 
 // UpdateStudentAttachment mengubah data lampiran mahasiswa di database
-func UpdateStudentAttachment(sa StudentAttachment) error {
-	logger.NewLogger().Info("UpdateStudentAttachment", zap.Any("student_attachment", sa))
-	_, err := database.DB.Exec(`UPDATE student_attachments SET 
+func UpdateStudentAttachment(ctx context.Context, sa StudentAttachment) error {
+	logger.FromContext(ctx).Info("UpdateStudentAttachment", zap.String("id", sa.ID), zap.String("file_name", sa.FileName))
+	_, err := database.DB.ExecContext(ctx, `UPDATE student_attachments SET 
 		student_id = ?, file_name = ?, file_url = ?, uploaded_at = ?, created_at = ?, updated_at = ?, deleted_at = ? 
 		WHERE id = ?`, sa.StudentID, sa.FileName, sa.FileURL, sa.UploadedAt, sa.CreatedAt, sa.UpdatedAt, sa.DeletedAt, sa.ID)
 	if err != nil {
@@ -120,13 +126,17 @@ func UpdateStudentAttachment(sa StudentAttachment) error {
 }
 
 // create or update student attachment
-func CreateOrUpdateStudentAttachment(sa StudentAttachment) (string, error) {
-	existing, err := GetStudentAttachmentByID(sa.ID)
+func CreateOrUpdateStudentAttachment(ctx context.Context, sa StudentAttachment) (_ string, err error) {
+	defer metrics.ObserveCall(metrics.MySQL, "upsert_student_attachment", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "mysql.CreateOrUpdateStudentAttachment", attribute.String("db.system", "mysql"))
+	defer tracing.End(span, &err)
+
+	existing, err := GetStudentAttachmentByID(ctx, sa.ID)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// data belum ada, silakan create
-			return CreateStudentAttachment(sa)
+			return CreateStudentAttachment(ctx, sa)
 		}
 		// ada error lain, kembalikan errornya aja
 		return "", err
@@ -137,9 +147,7 @@ func CreateOrUpdateStudentAttachment(sa StudentAttachment) (string, error) {
 	sa.CreatedAt = existing.CreatedAt
 	sa.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
 
-	// logger.NewLogger().Info("UpdateStudentAttachment", zap.Any("student_attachment", sa))
-
-	err = UpdateStudentAttachment(sa)
+	err = UpdateStudentAttachment(ctx, sa)
 	if err != nil {
 		return "", err
 	}
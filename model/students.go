@@ -1,9 +1,16 @@
 package model
 
 import (
+	"context"
 	"database/sql"
+	"strconv"
+	"time"
 
 	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/metrics"
+	"webhook-listener-mekarisign/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Student merepresentasikan struktur tabel students di database
@@ -13,7 +20,7 @@ type Student struct {
 	Gender         sql.NullString `json:"gender"`
 	WhatsAppNumber sql.NullString `json:"whatsapp_number"`
 	Email          sql.NullString `json:"email"`
-	NIK            sql.NullString `json:"nik"`
+	NIK            sql.NullString `json:"nik" log:"pii"`
 	Province       sql.NullString `json:"province"`
 	City           sql.NullString `json:"city"`
 	Subdistrict    sql.NullString `json:"subdistrict"`
@@ -72,9 +79,13 @@ func GetAllStudents() ([]Student, error) {
 }
 
 // GetStudentByID mengambil satu data mahasiswa berdasarkan ID
-func GetStudentByID(id string) (*Student, error) {
+func GetStudentByID(ctx context.Context, id string) (_ *Student, err error) {
+	defer metrics.ObserveCall(metrics.MySQL, "get_student_by_id", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "mysql.GetStudentByID", attribute.String("db.system", "mysql"))
+	defer tracing.End(span, &err)
+
 	var s Student
-	err := database.DB.QueryRow(`SELECT 
+	err = database.DB.QueryRowContext(ctx, `SELECT 
 		id, full_name, gender, whatsapp_number, email, nik, province, city, subdistrict, village, 
 		address_detail, last_education, work_now, program_type, want_to_work, batch_id, interview_id, 
 		dormitory, installment, referral_id, referral_source, birthdate, guardian_status, guardian_name, 
@@ -95,9 +106,13 @@ func GetStudentByID(id string) (*Student, error) {
 	return &s, nil
 }
 
-func GetStudentByEmail(email string) (*Student, error) {
+func GetStudentByEmail(ctx context.Context, email string) (_ *Student, err error) {
+	defer metrics.ObserveCall(metrics.MySQL, "get_student_by_email", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "mysql.GetStudentByEmail", attribute.String("db.system", "mysql"))
+	defer tracing.End(span, &err)
+
 	var s Student
-	err := database.DB.QueryRow(`SELECT 
+	err = database.DB.QueryRowContext(ctx, `SELECT 
 		id, full_name, gender, whatsapp_number, email, nik, province, city, subdistrict, village, 
 		address_detail, last_education, work_now, program_type, want_to_work, batch_id, interview_id, 
 		dormitory, installment, referral_id, referral_source, birthdate, guardian_status, guardian_name, 
@@ -136,7 +151,7 @@ func CreateStudent(s Student) (string, error) {
 		return "", err
 	}
 	lastID, _ := result.LastInsertId()
-	return string(lastID), nil
+	return strconv.FormatInt(lastID, 10), nil
 }
 
 // UpdateStudent memperbarui data mahasiswa berdasarkan ID
@@ -1,27 +1,186 @@
 package router
 
 import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
 	"webhook-listener-mekarisign/config"
 	"webhook-listener-mekarisign/database"
 	"webhook-listener-mekarisign/handler"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/metrics"
 	"webhook-listener-mekarisign/service"
+	"webhook-listener-mekarisign/tracing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
 )
 
-func SetupRoutes(e *echo.Echo, db *database.Database, cfg *config.Config, rabbitMQ *service.RabbitMQService) {
+func SetupRoutes(e *echo.Echo, db *database.Database, cfg *config.Config, templates *service.TemplateRegistry, rabbitMQ *service.RabbitMQService, settings *service.SettingsService, notifications *service.NotificationService, staff *service.StaffNotificationService, log *zap.Logger) {
+	ledger := service.NewLedgerService(db)
+	pricing := service.NewPricingService(db, cfg, settings)
+	xendit := service.NewTenantXenditServices(cfg)
+	receipts := service.NewReceiptService(db, templates, cfg)
+
+	e.Use(correlationID(log))
+	e.Use(requestTracing())
+	e.Use(requestMetrics())
+
 	// Webhook Handler
-	h := handler.NewWebhookHandler(db, service.NewXenditService(cfg), cfg, rabbitMQ)
+	h := handler.NewWebhookHandler(db, xendit, cfg, templates, notifications, staff, receipts, ledger, pricing, settings)
 	e.POST("/webhook", h.HandleWebhook)
 	e.GET("/webhook", h.HandleWebhook)
+	e.POST("/webhook/:tenant", h.HandleWebhook)
+	e.GET("/webhook/:tenant", h.HandleWebhook)
+
+	// Kuitansi PDF, ID acak pada URL berfungsi sebagai token
+	receiptHandler := handler.NewReceiptHandler(receipts)
+	e.GET("/receipts/:id", receiptHandler.Download)
 
 	// Invoice Handler
-	xs := service.NewXenditService(cfg)
-	invoiceHandler := handler.NewInvoiceHandler(xs)
-	e.POST("/invoice", invoiceHandler.CreateInvoice)
+	invoiceHandler := handler.NewInvoiceHandler(xendit, ledger, settings, cfg)
+	e.POST("/invoice", invoiceHandler.CreateInvoice, apiKeyAuth(cfg.InvoiceAPIKeys...))
+
+	// Admin endpoints
+	admin := e.Group("/admin", adminAuth(cfg))
+	adminInvoiceHandler := handler.NewAdminInvoiceHandler(xendit, ledger, settings, cfg)
+	admin.GET("/invoices/:external_id", adminInvoiceHandler.GetInvoiceChain)
+	admin.POST("/invoices/:external_id/expire", adminInvoiceHandler.ExpireInvoice)
+	admin.POST("/invoices/:external_id/replace", adminInvoiceHandler.ReplaceInvoice)
+
+	adminPricingHandler := handler.NewAdminPricingHandler(pricing, cfg)
+	admin.GET("/pricing/rules", adminPricingHandler.ListRules)
+	admin.POST("/pricing/rules", adminPricingHandler.SaveRule)
+	admin.PUT("/pricing/rules/:id", adminPricingHandler.SaveRule)
+	admin.DELETE("/pricing/rules/:id", adminPricingHandler.DeleteRule)
+	admin.GET("/pricing/quote", adminPricingHandler.Quote)
+
+	adminSettingsHandler := handler.NewAdminSettingsHandler(settings, cfg)
+	admin.GET("/settings/:tenant", adminSettingsHandler.GetSettings)
+	admin.PATCH("/settings/:tenant", adminSettingsHandler.UpdateSettings)
+	admin.GET("/settings/:tenant/audit", adminSettingsHandler.GetAuditLog)
 
-	// Health check
+	adminQueueHandler := handler.NewAdminQueueHandler(rabbitMQ)
+	admin.GET("/queue/dead-letters", adminQueueHandler.ListDeadLetters)
+	admin.POST("/queue/dead-letters/requeue", adminQueueHandler.RequeueDeadLetters)
+
+	adminNotificationHandler := handler.NewAdminNotificationHandler(notifications)
+	admin.GET("/notifications/preferences/:recipient", adminNotificationHandler.GetPreference)
+	admin.PUT("/notifications/preferences/:recipient", adminNotificationHandler.UpdatePreference)
+	admin.GET("/notifications/:key", adminNotificationHandler.GetDeliveries)
+
+	adminTemplateHandler := handler.NewAdminTemplateHandler(templates, rabbitMQ, cfg)
+	admin.GET("/templates/:tenant", adminTemplateHandler.ListTemplates)
+	admin.GET("/templates/:tenant/:name", adminTemplateHandler.Preview)
+	admin.POST("/templates/:tenant/:name/preview", adminTemplateHandler.Preview)
+	admin.POST("/templates/:tenant/:name/send-test", adminTemplateHandler.SendTest)
+
+	// Health check, /health dipertahankan untuk monitoring lama
+	healthHandler := handler.NewHealthHandler(db, rabbitMQ, xendit, cfg)
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(200, "ok")
 	})
+	e.GET("/health/live", healthHandler.Live)
+	e.GET("/health/ready", healthHandler.Ready)
+}
+
+// maxCorrelationIDLength membatasi ID dari pemanggil agar tidak membanjiri log
+const maxCorrelationIDLength = 128
+
+// correlationID memakai header X-Correlation-ID dari pemanggil (atau membuat ID baru),
+// menyimpannya bersama logger di context request dan mengembalikannya di header response
+func correlationID(log *zap.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(logger.CorrelationIDHeader)
+			if id == "" || len(id) > maxCorrelationIDLength {
+				id = logger.NewCorrelationID()
+			}
+			c.SetRequest(req.WithContext(logger.WithCorrelationID(logger.WithLogger(req.Context(), log), id)))
+			c.Response().Header().Set(logger.CorrelationIDHeader, id)
+			return next(c)
+		}
+	}
+}
+
+// requestTracing membuat span server untuk setiap request, melanjutkan trace pemanggil jika ada
+func requestTracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx, span := tracing.StartServer(req.Context(), req.Header, req.Method+" "+c.Path(),
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", c.Path()),
+				attribute.String("correlation_id", logger.CorrelationID(req.Context())),
+			)
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+			err := next(c)
+
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
+
+// requestMetrics mencatat lama setiap request per route ke metrics
+func requestMetrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+			metrics.ObserveHTTP(c.Request().Method, c.Path(), status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// apiKeyAuth hanya meneruskan request yang header X-API-Key-nya cocok dengan salah satu key
+func apiKeyAuth(keys ...string) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:X-API-Key",
+		Validator: func(key string, c echo.Context) (bool, error) {
+			for _, k := range keys {
+				if k != "" && subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	})
+}
+
+// adminAuth menerima key admin per orang (nama pemiliknya disimpan sebagai pelaku untuk audit trail)
+// dan key admin bersama, yang hanya boleh dipakai untuk endpoint tanpa audit trail
+func adminAuth(cfg *config.Config) echo.MiddlewareFunc {
+	personal := cfg.AdminKeys()
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:X-API-Key",
+		Validator: func(key string, c echo.Context) (bool, error) {
+			for k, name := range personal {
+				if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+					c.Set(handler.AdminActorKey, name)
+					return true, nil
+				}
+			}
+			return cfg.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) == 1, nil
+		},
+	})
 }
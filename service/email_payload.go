@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+)
+
+// EmailPayloadVersion adalah versi skema EmailPayload yang dihasilkan service ini.
+// Pesan tanpa version dianggap versi 1.
+const EmailPayloadVersion = "2"
+
+// maxAttachmentSize membatasi ukuran lampiran yang diunduh dari URL
+const maxAttachmentSize = 10 << 20
+
+// templateIDPattern mencegah template ID dipakai untuk membaca file di luar folder template
+var templateIDPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// attachmentClient dipakai untuk mengunduh lampiran berdasarkan URL
+var attachmentClient = newHTTPClient(30 * time.Second)
+
+// Validate memeriksa payload sesuai schema/email_payload.schema.json
+func (p EmailPayload) Validate() error {
+	switch p.Version {
+	case "", "1", EmailPayloadVersion:
+	default:
+		return fmt.Errorf("unsupported email payload version %q", p.Version)
+	}
+	if p.Subject == "" {
+		return errors.New("subject is required")
+	}
+	if _, err := mail.ParseAddress(p.To); err != nil {
+		return fmt.Errorf("invalid to address %q", p.To)
+	}
+	for _, addr := range append(append([]string{}, p.Cc...), p.Bcc...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid cc/bcc address %q", addr)
+		}
+	}
+	if p.ReplyTo != "" {
+		if _, err := mail.ParseAddress(p.ReplyTo); err != nil {
+			return fmt.Errorf("invalid reply_to address %q", p.ReplyTo)
+		}
+	}
+	if p.Format != "" && p.Format != "html" && p.Format != "text" {
+		return fmt.Errorf("format must be html or text, got %q", p.Format)
+	}
+	if p.Msg == "" && p.Template == nil {
+		return errors.New("either msg or template is required")
+	}
+	if p.Template != nil && !templateIDPattern.MatchString(p.Template.ID) {
+		return fmt.Errorf("invalid template id %q", p.Template.ID)
+	}
+	for i, a := range p.Attachments {
+		if a.Filename == "" {
+			return fmt.Errorf("attachments[%d].filename is required", i)
+		}
+		if a.URL == "" && len(a.Content) == 0 {
+			return fmt.Errorf("attachments[%d] needs url or content", i)
+		}
+	}
+	return nil
+}
+
+// Resolve melengkapi payload sebelum dikirim: merender template jika msg kosong dan mengunduh lampiran
+// yang berupa URL. Template milik tenant dipakai jika ada, selain itu template bawaan.
+// Error yang tidak akan berhasil jika dicoba ulang dikembalikan sebagai PermanentError.
+func (p *EmailPayload) Resolve(ctx context.Context, templates *TemplateRegistry, cfg *config.Config, tenantID string) error {
+	if err := p.Validate(); err != nil {
+		return PermanentError(err)
+	}
+
+	if p.Msg == "" && p.Template != nil {
+		msg, err := templates.Render(cfg.Tenant(tenantID), p.Template.ID+".html", p.Template.Variables)
+		if err != nil {
+			return PermanentError(err)
+		}
+		p.Msg = msg
+		p.Format = "html"
+	}
+
+	allowed := append([]string{cfg.PublicBaseURL}, cfg.AttachmentURLPrefixes...)
+	for i := range p.Attachments {
+		a := &p.Attachments[i]
+		if len(a.Content) > 0 || a.URL == "" {
+			continue
+		}
+		if err := fetchAttachment(ctx, a, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentURLAllowed bernilai true jika URL memakai scheme dan host yang sama dengan salah satu prefix
+// dan path-nya berada di bawah path prefix tersebut. Prefix kosong diabaikan.
+func attachmentURLAllowed(u *url.URL, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		base, err := url.Parse(prefix)
+		if err != nil || base.Host == "" {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+			continue
+		}
+		basePath := strings.TrimSuffix(base.Path, "/")
+		if u.Path == basePath || strings.HasPrefix(u.Path, basePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchAttachment mengunduh isi lampiran dari URL yang diizinkan (public_base_url atau attachment_url_prefixes),
+// termasuk setiap redirect-nya, agar pesan di queue tidak bisa dipakai untuk mengakses jaringan internal.
+// URL yang tidak diizinkan dan status 4xx dianggap permanen.
+func fetchAttachment(ctx context.Context, a *EmailAttachment, allowed []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return PermanentError(fmt.Errorf("invalid attachment url: %v", err))
+	}
+	if !attachmentURLAllowed(req.URL, allowed) {
+		return PermanentError(fmt.Errorf("attachment %s url is not in the allowed prefixes", a.Filename))
+	}
+
+	client := *attachmentClient
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !attachmentURLAllowed(next.URL, allowed) {
+			return PermanentError(fmt.Errorf("attachment %s redirects outside the allowed prefixes", a.Filename))
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if errors.Is(err, ErrPermanent) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download attachment %s: %v", a.Filename, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return PermanentError(fmt.Errorf("attachment %s returned status %d", a.Filename, resp.StatusCode))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("attachment %s returned status %d", a.Filename, resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download attachment %s: %v", a.Filename, err)
+	}
+	if len(content) > maxAttachmentSize {
+		return PermanentError(fmt.Errorf("attachment %s is larger than %d bytes", a.Filename, maxAttachmentSize))
+	}
+
+	a.Content = content
+	if a.ContentType == "" {
+		a.ContentType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	}
+	if a.Filename == "" {
+		a.Filename = path.Base(req.URL.Path)
+	}
+	return nil
+}
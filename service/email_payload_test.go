@@ -0,0 +1,39 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAttachmentURLAllowed(t *testing.T) {
+	prefixes := []string{"", "https://webhook.go-global.id", "https://files.example.com/lampiran/"}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://webhook.go-global.id/receipts/abc", true},
+		{"https://WEBHOOK.go-global.id/receipts/abc", true},
+		{"https://files.example.com/lampiran/kuitansi.pdf", true},
+		{"https://files.example.com/lampiran", true},
+		{"https://files.example.com/lampiran-lain/x.pdf", false},
+		{"https://files.example.com/other.pdf", false},
+		{"http://webhook.go-global.id/receipts/abc", false},
+		{"https://webhook.go-global.id.evil.com/receipts/abc", false},
+		{"https://webhook.go-global.id:8443/receipts/abc", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"file:///etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := attachmentURLAllowed(u, prefixes); got != tt.want {
+				t.Errorf("attachmentURLAllowed(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
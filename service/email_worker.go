@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+const EmailBounceCollection = "email_bounces"
+
+// emailWorkerPrefetch adalah jumlah pesan yang boleh dipegang worker sebelum di-ack
+const emailWorkerPrefetch = 5
+
+// EmailBounce mencatat email yang ditolak permanen oleh server SMTP
+type EmailBounce struct {
+	To            string    `bson:"to" json:"to" log:"pii"`
+	Subject       string    `bson:"subject" json:"subject"`
+	SMTPCode      int       `bson:"smtp_code,omitempty" json:"smtp_code,omitempty"`
+	Error         string    `bson:"error" json:"error"`
+	CorrelationID string    `bson:"correlation_id,omitempty" json:"correlation_id,omitempty"`
+	BouncedAt     time.Time `bson:"bounced_at" json:"bounced_at"`
+}
+
+// EmailWorker mengambil EmailPayload dari queue dan mengirimnya lewat SMTP.
+// Kegagalan sementara dicoba ulang lewat queue retry, penolakan permanen dicatat sebagai bounce.
+type EmailWorker struct {
+	rabbitMQ  *RabbitMQService
+	mailer    *SMTPMailer
+	bounces   *mongo.Collection
+	templates *TemplateRegistry
+	cfg       *config.Config
+	log       *zap.Logger
+}
+
+func NewEmailWorker(db *database.Database, rabbitMQ *RabbitMQService, mailer *SMTPMailer, templates *TemplateRegistry, cfg *config.Config, log *zap.Logger) *EmailWorker {
+	return &EmailWorker{
+		rabbitMQ:  rabbitMQ,
+		mailer:    mailer,
+		bounces:   db.DB.Collection(EmailBounceCollection),
+		templates: templates,
+		cfg:       cfg,
+		log:       log,
+	}
+}
+
+// Run memproses queue sampai ctx selesai, mendaftar ulang consumer jika koneksi RabbitMQ putus
+func (w *EmailWorker) Run(ctx context.Context) {
+	ctx = logger.WithLogger(ctx, w.log)
+	for ctx.Err() == nil {
+		msgs, err := w.rabbitMQ.Consume(ctx, emailWorkerPrefetch)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrRabbitMQClosed) {
+				return
+			}
+			w.log.Error("Failed to start consuming email queue", zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(rabbitMQMinBackoff):
+			}
+			continue
+		}
+		w.log.Info("Email worker consuming", zap.String("queue", w.rabbitMQ.queueName))
+		w.rabbitMQ.ProcessMessages(msgs, w.handle)
+	}
+}
+
+// handle mengirim satu pesan; error yang dikembalikan menentukan retry atau dead letter
+func (w *EmailWorker) handle(msg amqp091.Delivery) (err error) {
+	ctx := tracing.Extract(logger.WithLogger(context.Background(), w.log), amqpHeaderCarrier(msg.Headers))
+	if msg.CorrelationId != "" {
+		ctx = logger.WithCorrelationID(ctx, msg.CorrelationId)
+	}
+	ctx, span := tracing.Start(ctx, "email.process", attribute.Int("retry", retryCount(msg.Headers)))
+	defer tracing.End(span, &err)
+
+	var payload EmailPayload
+	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+		return PermanentError(fmt.Errorf("invalid email payload: %v", err))
+	}
+
+	log := logger.FromContext(ctx).With(zap.String("to", payload.To), zap.String("subject", payload.Subject))
+	// render template dan unduh lampiran untuk payload versi 2
+	tenantID, _ := msg.Headers[TenantIDHeader].(string)
+	if err := payload.Resolve(ctx, w.templates, w.cfg, tenantID); err != nil {
+		return err
+	}
+	rejected, err := w.mailer.Send(ctx, payload)
+	for _, r := range rejected {
+		w.recordBounce(ctx, r.Address, payload.Subject, r.Err)
+	}
+	if err != nil {
+		if errors.Is(err, ErrPermanent) {
+			w.recordBounce(ctx, payload.To, payload.Subject, err)
+		}
+		return err
+	}
+	log.Info("Email sent")
+	return nil
+}
+
+// recordBounce menyimpan bounce ke MongoDB agar bisa ditindaklanjuti (misalnya alamat email salah)
+func (w *EmailWorker) recordBounce(ctx context.Context, to, subject string, cause error) {
+	bounce := EmailBounce{
+		To:            to,
+		Subject:       subject,
+		SMTPCode:      SMTPCode(cause),
+		Error:         cause.Error(),
+		CorrelationID: logger.CorrelationID(ctx),
+		BouncedAt:     time.Now(),
+	}
+	logger.FromContext(ctx).Warn("Email bounced", zap.Any("bounce", bounce))
+	if _, err := w.bounces.InsertOne(ctx, bounce); err != nil {
+		logger.FromContext(ctx).Error("Failed to record email bounce", zap.Error(err))
+	}
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"webhook-listener-mekarisign/logger"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// newHTTPClient membuat http.Client untuk panggilan keluar yang meneruskan correlation ID
+// dan trace context dari context request, serta membuat span untuk setiap request
+func newHTTPClient(timeout time.Duration) *http.Client {
+	client := logger.NewHTTPClient(timeout)
+	client.Transport = otelhttp.NewTransport(client.Transport)
+	return client
+}
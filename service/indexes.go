@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"webhook-listener-mekarisign/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionIndexes adalah index yang dibutuhkan service. Index unik menjaga idempotensi
+// saat webhook yang sama diproses bersamaan oleh beberapa request atau replica.
+var collectionIndexes = map[string][]mongo.IndexModel{
+	OutboxCollection: {
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "notification_key", Value: 1}}},
+	},
+	LedgerCollection: {
+		{Keys: bson.D{{Key: "external_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "document_id", Value: 1}, {Key: "payment_for", Value: 1}, {Key: "version", Value: 1}}},
+	},
+	ReceiptCollection: {
+		{Keys: bson.D{{Key: "external_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	StaffDigestCollection: {
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "event", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "digested_at", Value: 1}, {Key: "created_at", Value: 1}}},
+	},
+}
+
+// EnsureIndexes membuat index yang belum ada, dipanggil sekali saat startup. Gagal membuat index unik
+// biasanya berarti sudah ada data ganda yang harus dibersihkan dulu.
+func EnsureIndexes(ctx context.Context, db *database.Database) error {
+	for name, models := range collectionIndexes {
+		if _, err := db.DB.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"webhook-listener-mekarisign/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const LedgerCollection = "invoice_ledger"
+
+// LedgerStatusReplaced dipakai untuk invoice yang sudah dibatalkan dan diganti invoice baru
+const LedgerStatusReplaced = "REPLACED"
+
+// LedgerStatusCreating menandai external ID yang sedang dibuatkan invoice di Xendit. Entry ini dicatat
+// sebelum memanggil Xendit sehingga retry webhook tidak membuat invoice kedua.
+const LedgerStatusCreating = "CREATING"
+
+// ledgerReservationLease adalah batas waktu entry CREATING dianggap milik request yang sedang berjalan;
+// setelah itu request lain boleh mengambil alih (proses sebelumnya dianggap mati)
+const ledgerReservationLease = 2 * time.Minute
+
+// LedgerEntry mencatat satu invoice yang dibuat oleh service ini beserta status terakhirnya
+type LedgerEntry struct {
+	TenantID          string      `bson:"tenant_id" json:"tenant_id"`
+	ExternalID        string      `bson:"external_id" json:"external_id"`
+	InvoiceID         string      `bson:"invoice_id" json:"invoice_id"`
+	DocumentID        string      `bson:"document_id" json:"document_id"`
+	PaymentFor        int         `bson:"payment_for" json:"payment_for"`
+	Version           int         `bson:"version" json:"version"`
+	PayerEmail        string      `bson:"payer_email" json:"payer_email"`
+	PayerName         string      `bson:"payer_name,omitempty" json:"payer_name,omitempty"`
+	Description       string      `bson:"description,omitempty" json:"description,omitempty"`
+	InvoiceURL        string      `bson:"invoice_url,omitempty" json:"invoice_url,omitempty"`
+	Amount            float64     `bson:"amount" json:"amount"`
+	Status            string      `bson:"status" json:"status"`
+	CallbackProcessed bool        `bson:"callback_processed" json:"callback_processed"`
+	Replaces          string      `bson:"replaces,omitempty" json:"replaces,omitempty"`
+	ReplacedBy        string      `bson:"replaced_by,omitempty" json:"replaced_by,omitempty"`
+	ChangeReason      string      `bson:"change_reason,omitempty" json:"change_reason,omitempty"`
+	Pricing           *PriceQuote `bson:"pricing,omitempty" json:"pricing,omitempty"`
+	ProcessedAt       *time.Time  `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+	CreatedAt         time.Time   `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time   `bson:"updated_at" json:"updated_at"`
+}
+
+type LedgerService struct {
+	collection *mongo.Collection
+}
+
+func NewLedgerService(db *database.Database) *LedgerService {
+	return &LedgerService{collection: db.DB.Collection(LedgerCollection)}
+}
+
+// RecordInvoice menyimpan invoice baru ke ledger, atau memperbarui entry dengan external ID yang sama
+func (l *LedgerService) RecordInvoice(ctx context.Context, entry LedgerEntry) error {
+	now := time.Now()
+	entry.UpdatedAt = now
+	if entry.Version == 0 {
+		entry.Version = 1
+	}
+
+	set := bson.M{
+		"tenant_id":   entry.TenantID,
+		"invoice_id":  entry.InvoiceID,
+		"document_id": entry.DocumentID,
+		"payment_for": entry.PaymentFor,
+		"version":     entry.Version,
+		"payer_email": entry.PayerEmail,
+		"amount":      entry.Amount,
+		"status":      entry.Status,
+		"updated_at":  entry.UpdatedAt,
+	}
+	if entry.Pricing != nil {
+		set["pricing"] = entry.Pricing
+	}
+	if entry.PayerName != "" {
+		set["payer_name"] = entry.PayerName
+	}
+	if entry.Description != "" {
+		set["description"] = entry.Description
+	}
+	if entry.InvoiceURL != "" {
+		set["invoice_url"] = entry.InvoiceURL
+	}
+	if entry.Replaces != "" {
+		set["replaces"] = entry.Replaces
+		set["change_reason"] = entry.ChangeReason
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"external_id":        entry.ExternalID,
+			"callback_processed": false,
+			"created_at":         now,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err := l.collection.UpdateOne(ctx, bson.M{"external_id": entry.ExternalID}, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		// upsert lain menang lebih dulu, ulangi sebagai update biasa
+		_, err = l.collection.UpdateOne(ctx, bson.M{"external_id": entry.ExternalID}, update, opts)
+	}
+	return err
+}
+
+// Reserve mencatat entry CREATING sebelum invoice dibuat di Xendit. Jika external ID sudah ada di ledger,
+// entry yang ada dikembalikan dengan reserved false dan pemanggil tidak boleh membuat invoice baru,
+// kecuali berhasil mengambil alih reservasi yang kedaluwarsa lewat TakeOverReservation.
+func (l *LedgerService) Reserve(ctx context.Context, entry LedgerEntry) (*LedgerEntry, bool, error) {
+	now := time.Now()
+	entry.Status = LedgerStatusCreating
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	if entry.Version == 0 {
+		entry.Version = 1
+	}
+	_, err := l.collection.InsertOne(ctx, entry)
+	if err == nil {
+		return &entry, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+	existing, err := l.FindByExternalID(ctx, entry.ExternalID)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+// TakeOverReservation mengambil alih entry CREATING yang lebih lama dari ledgerReservationLease.
+// Hanya satu pemanggil yang mendapat true untuk setiap lease.
+func (l *LedgerService) TakeOverReservation(ctx context.Context, externalID string) (bool, error) {
+	now := time.Now()
+	res, err := l.collection.UpdateOne(ctx, bson.M{
+		"external_id": externalID,
+		"status":      LedgerStatusCreating,
+		"updated_at":  bson.M{"$lt": now.Add(-ledgerReservationLease)},
+	}, bson.M{"$set": bson.M{"updated_at": now}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// Release menghapus reservasi yang gagal dibuatkan invoice sehingga retry berikutnya bisa langsung mencoba lagi
+func (l *LedgerService) Release(ctx context.Context, externalID string) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"external_id": externalID, "status": LedgerStatusCreating})
+	return err
+}
+
+// Issued mengambil invoice yang sudah dibuat sejak waktu tertentu dan belum dibayar, dipakai rekonsiliasi
+// untuk memastikan email invoice sudah tercatat di outbox
+func (l *LedgerService) Issued(ctx context.Context, tenantID string, since time.Time) ([]LedgerEntry, error) {
+	cur, err := l.collection.Find(ctx, bson.M{
+		"tenant_id":          tenantID,
+		"created_at":         bson.M{"$gte": since},
+		"invoice_url":        bson.M{"$nin": bson.A{nil, ""}},
+		"payment_for":        bson.M{"$gt": 0}, // invoice dari POST /invoice tidak dikirim email oleh service ini
+		"replaced_by":        bson.M{"$in": bson.A{nil, ""}},
+		"callback_processed": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var entries []LedgerEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarkStatus memperbarui status invoice di ledger berdasarkan external ID
+func (l *LedgerService) MarkStatus(ctx context.Context, externalID string, status string) error {
+	_, err := l.collection.UpdateOne(ctx, bson.M{"external_id": externalID}, bson.M{
+		"$set": bson.M{"status": status, "updated_at": time.Now()},
+	})
+	return err
+}
+
+// MarkReplaced menandai invoice lama sudah digantikan invoice baru, callback untuk invoice lama akan diabaikan
+func (l *LedgerService) MarkReplaced(ctx context.Context, externalID string, replacedBy string, reason string) error {
+	_, err := l.collection.UpdateOne(ctx, bson.M{"external_id": externalID}, bson.M{
+		"$set": bson.M{
+			"status":        LedgerStatusReplaced,
+			"replaced_by":   replacedBy,
+			"change_reason": reason,
+			"updated_at":    time.Now(),
+		},
+	})
+	return err
+}
+
+// Chain mengambil seluruh rantai penggantian invoice untuk dokumen dan pembayaran yang sama, urut dari versi pertama
+func (l *LedgerService) Chain(ctx context.Context, documentID string, paymentFor int) ([]LedgerEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	cur, err := l.collection.Find(ctx, bson.M{"document_id": documentID, "payment_for": paymentFor}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var entries []LedgerEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarkProcessed menandai bahwa callback untuk invoice sudah diproses
+func (l *LedgerService) MarkProcessed(ctx context.Context, externalID string, status string) error {
+	now := time.Now()
+	_, err := l.collection.UpdateOne(ctx, bson.M{"external_id": externalID}, bson.M{
+		"$set": bson.M{
+			"status":             status,
+			"callback_processed": true,
+			"processed_at":       now,
+			"updated_at":         now,
+		},
+	})
+	return err
+}
+
+// FindByExternalID mengambil entry ledger, mengembalikan nil jika tidak ditemukan
+func (l *LedgerService) FindByExternalID(ctx context.Context, externalID string) (*LedgerEntry, error) {
+	var entry LedgerEntry
+	err := l.collection.FindOne(ctx, bson.M{"external_id": externalID}).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
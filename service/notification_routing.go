@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Jenis pesan notifikasi, menjadi bagian terakhir routing key notify.<channel>.<type>. Satu event bisa
+// menghasilkan beberapa jenis pesan (misalnya payment_received: ringkasan untuk staf, kuitansi dan email
+// pelunasan untuk siswa), sehingga consumer bisa berlangganan satu jenis saja. Notifikasi tanpa jenis
+// memakai nama event (contract_signed, processing_failed).
+const (
+	MessageInvoiceIssued    = "invoice_issued"
+	MessagePaymentSuccess   = "payment_success"
+	MessagePaymentCompleted = "payment_completed"
+	MessagePaymentReceipt   = "payment_receipt"
+	MessageStaffDigest      = "staff_digest"
+)
+
+// MessageVersion adalah versi format body pesan email, lihat EmailPayloadVersion
+const MessageVersion = EmailPayloadVersion
+
+// Header metadata pesan agar consumer bisa memfilter tanpa membaca body
+const (
+	MessageTypeHeader    = "x-message-type"
+	MessageVersionHeader = "x-message-version"
+	TenantIDHeader       = "x-tenant-id"
+)
+
+// MessageMeta menentukan routing key dan header pesan notifikasi, Type adalah salah satu jenis pesan di atas
+type MessageMeta struct {
+	Type     string `bson:"type" json:"type"`
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+}
+
+// EmailRoutingKey mengembalikan routing key untuk email, misalnya notify.email.payment_success.
+// Pesan tanpa jenis (misalnya outbox lama) dikirim sebagai notify.email.generic.
+func EmailRoutingKey(messageType string) string {
+	if messageType == "" {
+		messageType = "generic"
+	}
+	return "notify.email." + messageType
+}
+
+// messageHeaders menyalin metadata, correlation ID dan trace context ke header pesan agar consumer bisa meneruskannya
+func messageHeaders(ctx context.Context, meta MessageMeta) amqp091.Table {
+	headers := amqp091.Table{
+		MessageVersionHeader: MessageVersion,
+	}
+	if meta.Type != "" {
+		headers[MessageTypeHeader] = meta.Type
+	}
+	if meta.TenantID != "" {
+		headers[TenantIDHeader] = meta.TenantID
+	}
+	if id := logger.CorrelationID(ctx); id != "" {
+		headers[logger.CorrelationIDHeader] = id
+	}
+	tracing.Inject(ctx, amqpHeaderCarrier(headers))
+	return headers
+}
+
+// amqpHeaderCarrier menjadikan header AMQP sebagai carrier propagasi OpenTelemetry
+type amqpHeaderCarrier amqp091.Table
+
+func (c amqpHeaderCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c amqpHeaderCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c amqpHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
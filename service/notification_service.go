@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const NotificationPreferenceCollection = "notification_preferences"
+
+// Recipient adalah penerima notifikasi; Email dan Phone dipakai sesuai channel
+type Recipient struct {
+	Role  string `json:"role"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty" log:"pii"`
+	Phone string `json:"phone,omitempty" log:"pii"`
+}
+
+// ID mengembalikan identitas penerima untuk preferensi: email (huruf kecil), atau nomor telepon
+func (r Recipient) ID() string {
+	if r.Email != "" {
+		return strings.ToLower(r.Email)
+	}
+	return r.Phone
+}
+
+// Notification adalah satu kejadian untuk satu penerima beserta isi pesan per channel.
+// Key mengidentifikasi kejadian (misalnya external ID invoice) sehingga webhook yang dikirim ulang
+// tidak membuat notifikasi ganda. Type menentukan routing key pesan, kosong berarti sama dengan Event.
+type Notification struct {
+	Key       string
+	Event     string
+	Type      string
+	TenantID  string
+	Recipient Recipient
+	Email     *EmailPayload
+	WhatsApp  *WhatsAppPayload
+}
+
+// NotificationPreference menyimpan channel yang tidak ingin dipakai oleh seorang penerima
+type NotificationPreference struct {
+	Recipient        string    `bson:"_id" json:"recipient"`
+	DisabledChannels []string  `bson:"disabled_channels" json:"disabled_channels"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updated_at"`
+	UpdatedBy        string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+}
+
+func (p *NotificationPreference) allows(channel string) bool {
+	return p == nil || !containsFold(p.DisabledChannels, channel)
+}
+
+// ChannelDelivery adalah status pengiriman satu channel untuk satu penerima
+type ChannelDelivery struct {
+	Event     string     `json:"event"`
+	Role      string     `json:"role"`
+	Channel   string     `json:"channel"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// NotificationService menentukan channel untuk setiap event dan penerima (aturan di konfigurasi notifications
+// dan preferensi penerima), lalu mencatat setiap channel ke outbox untuk dikirim relay
+type NotificationService struct {
+	outbox      *OutboxService
+	preferences *mongo.Collection
+	cfg         *config.Config
+}
+
+func NewNotificationService(db *database.Database, outbox *OutboxService, cfg *config.Config) *NotificationService {
+	return &NotificationService{
+		outbox:      outbox,
+		preferences: db.DB.Collection(NotificationPreferenceCollection),
+		cfg:         cfg,
+	}
+}
+
+// Notify mencatat semua notifikasi sekaligus ke outbox. Channel yang tidak bisa dipakai
+// (penerima menonaktifkan atau alamat kosong) dicatat dengan status SKIPPED.
+func (n *NotificationService) Notify(ctx context.Context, notifications ...Notification) error {
+	var msgs []OutboxMessage
+	for _, notif := range notifications {
+		pref, err := n.Preference(ctx, notif.Recipient.ID())
+		if err != nil {
+			return err
+		}
+
+		for _, channel := range n.cfg.Notifications.Channels(notif.Event, notif.Recipient.Role) {
+			// notifikasi tanpa isi untuk channel ini tidak ditujukan ke channel tersebut
+			if (channel == config.ChannelEmail && notif.Email == nil) || (channel == config.ChannelWhatsApp && notif.WhatsApp == nil) {
+				continue
+			}
+			msg, skipReason := n.message(notif, channel)
+			if skipReason == "" && !pref.allows(channel) {
+				skipReason = "recipient disabled this channel"
+			}
+			msg.Key = fmt.Sprintf("%s:%s:%s:%s:%s", notif.Key, notif.Event, notif.Recipient.Role, notif.Recipient.ID(), channel)
+			msg.NotificationKey = notif.Key
+			msg.Event = notif.Event
+			msg.Role = notif.Recipient.Role
+			msg.TenantID = notif.TenantID
+			msg.Channel = channel
+			if skipReason != "" {
+				msg.Status = OutboxStatusSkipped
+				msg.LastError = skipReason
+				logger.FromContext(ctx).Info("Notification channel skipped",
+					zap.String("key", msg.Key), zap.String("reason", skipReason))
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	return n.outbox.Enqueue(ctx, msgs...)
+}
+
+// message menyiapkan isi pesan untuk channel, atau alasan channel dilewati
+func (n *NotificationService) message(notif Notification, channel string) (OutboxMessage, string) {
+	meta := MessageMeta{Type: notif.Type, TenantID: notif.TenantID}
+	if meta.Type == "" {
+		meta.Type = notif.Event
+	}
+	switch channel {
+	case config.ChannelEmail:
+		payload := *notif.Email
+		if payload.To == "" {
+			payload.To = notif.Recipient.Email
+		}
+		if payload.To == "" {
+			return OutboxMessage{}, "recipient has no email address"
+		}
+		return OutboxMessage{Meta: meta, Email: &payload}, ""
+	case config.ChannelWhatsApp:
+		payload := *notif.WhatsApp
+		if payload.Recipient == "" {
+			payload.Recipient = notif.Recipient.Phone
+		}
+		if payload.Recipient == "" {
+			return OutboxMessage{}, "recipient has no phone number"
+		}
+		return OutboxMessage{Meta: meta, WhatsApp: &payload}, ""
+	}
+	return OutboxMessage{}, fmt.Sprintf("unknown channel %q", channel)
+}
+
+// Deliveries mengembalikan status setiap channel untuk kejadian dengan key tertentu
+func (n *NotificationService) Deliveries(ctx context.Context, key string) ([]ChannelDelivery, error) {
+	msgs, err := n.outbox.FindByNotification(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]ChannelDelivery, 0, len(msgs))
+	for _, m := range msgs {
+		deliveries = append(deliveries, ChannelDelivery{
+			Event:     m.Event,
+			Role:      m.Role,
+			Channel:   m.Channel,
+			Status:    m.Status,
+			Attempts:  m.Attempts,
+			LastError: m.LastError,
+			SentAt:    m.SentAt,
+			UpdatedAt: m.UpdatedAt,
+		})
+	}
+	return deliveries, nil
+}
+
+// Preference mengambil preferensi penerima, nil jika belum pernah diatur
+func (n *NotificationService) Preference(ctx context.Context, recipient string) (*NotificationPreference, error) {
+	if recipient == "" {
+		return nil, nil
+	}
+	var pref NotificationPreference
+	err := n.preferences.FindOne(ctx, bson.M{"_id": recipient}).Decode(&pref)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load notification preference: %v", err)
+	}
+	return &pref, nil
+}
+
+// SetPreference menyimpan channel yang dinonaktifkan untuk penerima
+func (n *NotificationService) SetPreference(ctx context.Context, recipient string, disabled []string, actor string) (*NotificationPreference, error) {
+	for _, ch := range disabled {
+		if ch != config.ChannelEmail && ch != config.ChannelWhatsApp {
+			return nil, fmt.Errorf("unknown channel %q", ch)
+		}
+	}
+	if disabled == nil {
+		disabled = []string{}
+	}
+
+	pref := NotificationPreference{
+		Recipient:        strings.ToLower(recipient),
+		DisabledChannels: disabled,
+		UpdatedAt:        time.Now(),
+		UpdatedBy:        actor,
+	}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := n.preferences.ReplaceOne(ctx, bson.M{"_id": pref.Recipient}, pref, opts); err != nil {
+		return nil, fmt.Errorf("failed to save notification preference: %v", err)
+	}
+	return &pref, nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
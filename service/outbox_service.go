@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const OutboxCollection = "outbox"
+
+// Channel pengiriman pesan outbox
+const (
+	OutboxChannelEmail    = config.ChannelEmail
+	OutboxChannelWhatsApp = config.ChannelWhatsApp
+)
+
+// Status pesan outbox. SKIPPED dicatat oleh NotificationService untuk channel yang tidak dikirim.
+const (
+	OutboxStatusPending = "PENDING"
+	OutboxStatusSent    = "SENT"
+	OutboxStatusFailed  = "FAILED"
+	OutboxStatusSkipped = "SKIPPED"
+)
+
+// outboxLease adalah lama pesan dikunci oleh relay yang mengambilnya; jika relay mati
+// sebelum selesai, pesan otomatis diambil ulang setelah lease habis
+const outboxLease = 2 * time.Minute
+
+// Backoff antar percobaan pengiriman ulang
+const (
+	outboxMinBackoff = 10 * time.Second
+	outboxMaxBackoff = 1 * time.Hour
+)
+
+// OutboxMessage adalah satu side effect (email atau WhatsApp) yang harus dikirim minimal sekali.
+// Key unik per side effect (index unik, lihat EnsureIndexes) sehingga webhook yang dikirim ulang tidak membuat pesan ganda.
+type OutboxMessage struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key             string             `bson:"key" json:"key"`
+	NotificationKey string             `bson:"notification_key,omitempty" json:"notification_key,omitempty"`
+	Event           string             `bson:"event,omitempty" json:"event,omitempty"`
+	Role            string             `bson:"role,omitempty" json:"role,omitempty"`
+	TenantID        string             `bson:"tenant_id" json:"tenant_id"`
+	Channel         string             `bson:"channel" json:"channel"`
+	Meta            MessageMeta        `bson:"meta" json:"meta"`
+	Email           *EmailPayload      `bson:"email,omitempty" json:"email,omitempty"`
+	WhatsApp        *WhatsAppPayload   `bson:"whatsapp,omitempty" json:"whatsapp,omitempty"`
+	CorrelationID   string             `bson:"correlation_id,omitempty" json:"correlation_id,omitempty"`
+	Status          string             `bson:"status" json:"status"`
+	Attempts        int                `bson:"attempts" json:"attempts"`
+	LastError       string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt   time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	SentAt          *time.Time         `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// OutboxService menyimpan side effect ke collection outbox dan relay-nya mengirim ke RabbitMQ/WhatsApp
+// dengan retry, sehingga crash setelah invoice dibuat tidak menghilangkan email atau notifikasi
+type OutboxService struct {
+	collection  *mongo.Collection
+	rabbitMQ    *RabbitMQService
+	cfg         *config.Config
+	maxAttempts int
+	wake        chan struct{}
+	log         *zap.Logger
+}
+
+func NewOutboxService(db *database.Database, rabbitMQ *RabbitMQService, cfg *config.Config, log *zap.Logger) *OutboxService {
+	maxAttempts, err := strconv.Atoi(cfg.OutboxMaxAttempts)
+	if err != nil || maxAttempts < 1 {
+		maxAttempts = 10
+	}
+	return &OutboxService{
+		collection:  db.DB.Collection(OutboxCollection),
+		rabbitMQ:    rabbitMQ,
+		cfg:         cfg,
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+		log:         log,
+	}
+}
+
+// Enqueue menyimpan pesan ke outbox. Pesan dengan key yang sudah ada tidak ditimpa.
+// Relay dibangunkan agar pesan langsung dikirim tanpa menunggu interval berikutnya.
+func (o *OutboxService) Enqueue(ctx context.Context, msgs ...OutboxMessage) error {
+	now := time.Now()
+	for _, msg := range msgs {
+		if msg.Key == "" {
+			return errors.New("outbox message key is required")
+		}
+		if msg.Status != OutboxStatusSkipped {
+			msg.Status = OutboxStatusPending
+		}
+		msg.CorrelationID = logger.CorrelationID(ctx)
+		msg.NextAttemptAt = now
+		msg.CreatedAt = now
+		msg.UpdatedAt = now
+
+		opts := options.Update().SetUpsert(true)
+		_, err := o.collection.UpdateOne(ctx, bson.M{"key": msg.Key}, bson.M{"$setOnInsert": msg}, opts)
+		// upsert bersamaan dengan key yang sama ditolak index unik, artinya pesan sudah tercatat
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to enqueue outbox message %s: %v", msg.Key, err)
+		}
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// FindByNotification mengambil semua pesan outbox milik satu kejadian notifikasi
+func (o *OutboxService) FindByNotification(ctx context.Context, notificationKey string) ([]OutboxMessage, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := o.collection.Find(ctx, bson.M{"notification_key": notificationKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var msgs []OutboxMessage
+	if err := cur.All(ctx, &msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// Run mengirim pesan outbox yang jatuh tempo setiap interval atau saat ada pesan baru, sampai ctx selesai
+func (o *OutboxService) Run(ctx context.Context, interval time.Duration) {
+	ctx = logger.WithLogger(ctx, o.log)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		o.DeliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// DeliverDue mengirim semua pesan yang jatuh tempo dan mengembalikan jumlah yang berhasil terkirim
+func (o *OutboxService) DeliverDue(ctx context.Context) int {
+	sent := 0
+	for ctx.Err() == nil {
+		msg, err := o.claim(ctx)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to claim outbox message", zap.Error(err))
+			return sent
+		}
+		if msg == nil {
+			return sent
+		}
+		if o.deliver(ctx, msg) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// claim mengambil satu pesan jatuh tempo dan menguncinya selama outboxLease,
+// sehingga beberapa instance bisa menjalankan relay bersamaan
+func (o *OutboxService) claim(ctx context.Context) (*OutboxMessage, error) {
+	now := time.Now()
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var msg OutboxMessage
+	err := o.collection.FindOneAndUpdate(ctx,
+		bson.M{"status": OutboxStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{"next_attempt_at": now.Add(outboxLease), "updated_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		opts,
+	).Decode(&msg)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// deliver mengirim satu pesan lalu mencatat hasilnya; pesan gagal dijadwalkan ulang dengan backoff
+// sampai batas percobaan tercapai
+func (o *OutboxService) deliver(ctx context.Context, msg *OutboxMessage) bool {
+	ctx = logger.WithCorrelationID(ctx, msg.CorrelationID)
+	log := logger.FromContext(ctx).With(
+		zap.String("outbox_key", msg.Key),
+		zap.String("channel", msg.Channel),
+		zap.Int("attempt", msg.Attempts))
+
+	var err error
+	switch {
+	case msg.Channel == OutboxChannelEmail && msg.Email != nil:
+		err = o.rabbitMQ.PublishJSON(ctx, msg.Meta, *msg.Email)
+	case msg.Channel == OutboxChannelWhatsApp && msg.WhatsApp != nil:
+		err = SendWhatsAppMessage(ctx, o.cfg, *msg.WhatsApp)
+	default:
+		err = fmt.Errorf("unknown outbox channel %q", msg.Channel)
+	}
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	if err == nil {
+		set["status"] = OutboxStatusSent
+		set["sent_at"] = now
+		set["last_error"] = ""
+		log.Info("Outbox message delivered")
+	} else {
+		set["last_error"] = err.Error()
+		if msg.Attempts >= o.maxAttempts {
+			set["status"] = OutboxStatusFailed
+			log.Error("Outbox message failed permanently", zap.Error(err))
+		} else {
+			set["next_attempt_at"] = now.Add(outboxBackoff(msg.Attempts))
+			log.Warn("Outbox message delivery failed, will retry", zap.Error(err))
+		}
+	}
+
+	// context terpisah agar hasil tetap tercatat walaupun ctx dibatalkan saat shutdown
+	if _, uerr := o.collection.UpdateOne(context.WithoutCancel(ctx), bson.M{"_id": msg.ID}, bson.M{"$set": set}); uerr != nil {
+		log.Error("Failed to update outbox message", zap.Error(uerr))
+	}
+	return err == nil
+}
+
+// outboxBackoff menggandakan jeda setiap percobaan, mulai outboxMinBackoff sampai outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxMinBackoff
+	for i := 1; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
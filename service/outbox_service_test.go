@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	if got := outboxBackoff(0); got != outboxMinBackoff {
+		t.Errorf("outboxBackoff(0) = %v, want %v", got, outboxMinBackoff)
+	}
+
+	// jeda berlipat dua tiap percobaan sampai mentok di outboxMaxBackoff
+	want := outboxMinBackoff
+	for attempts := 1; attempts <= 20; attempts++ {
+		if got := outboxBackoff(attempts); got != want {
+			t.Fatalf("outboxBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+		if want *= 2; want > outboxMaxBackoff {
+			want = outboxMaxBackoff
+		}
+	}
+
+	if got := outboxBackoff(1 << 30); got != time.Hour {
+		t.Errorf("outboxBackoff(huge) = %v, want 1h", got)
+	}
+}
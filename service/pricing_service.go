@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const PricingRuleCollection = "pricing_rules"
+
+// Jenis aturan harga yang didukung
+const (
+	RuleReferral    = "referral"
+	RuleEarlyBird   = "early_bird"
+	RulePromoCode   = "promo_code"
+	RuleScholarship = "scholarship"
+)
+
+// ErrPricingRuleNotFound dikembalikan saat memperbarui aturan yang tidak ada
+var ErrPricingRuleNotFound = errors.New("pricing rule not found")
+
+// ErrUnknownProgram dikembalikan jika program siswa tidak ada di daftar harga
+var ErrUnknownProgram = errors.New("unknown program type")
+
+// PricingRule adalah satu aturan potongan harga yang disimpan di collection pricing_rules.
+// Potongan memakai Percent jika diisi, selain itu memakai Amount (nominal rupiah).
+type PricingRule struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type         string             `bson:"type" json:"type"`
+	Name         string             `bson:"name" json:"name"`
+	Code         string             `bson:"code,omitempty" json:"code,omitempty"`
+	Percent      float64            `bson:"percent,omitempty" json:"percent,omitempty"`
+	Amount       float64            `bson:"amount,omitempty" json:"amount,omitempty"`
+	ProgramTypes []string           `bson:"program_types,omitempty" json:"program_types,omitempty"`
+	PaymentFor   int                `bson:"payment_for,omitempty" json:"payment_for,omitempty"` // 0 = semua pembayaran
+	StudentIDs   []string           `bson:"student_ids,omitempty" json:"student_ids,omitempty"`
+	StartsAt     *time.Time         `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt       *time.Time         `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+	Priority     int                `bson:"priority" json:"priority"`
+	Active       bool               `bson:"active" json:"active"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// PriceAdjustment adalah potongan yang diterapkan pada harga, Amount bernilai negatif
+type PriceAdjustment struct {
+	RuleID      string  `bson:"rule_id" json:"rule_id"`
+	Rule        string  `bson:"rule" json:"rule"`
+	Description string  `bson:"description" json:"description"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// PriceQuote adalah hasil perhitungan harga beserta rinciannya
+type PriceQuote struct {
+	ProgramType string            `bson:"program_type" json:"program_type"`
+	ProgramName string            `bson:"program_name" json:"program_name"`
+	PaymentFor  int               `bson:"payment_for" json:"payment_for"`
+	ListPrice   float64           `bson:"list_price" json:"list_price"`
+	Dormitory   float64           `bson:"dormitory" json:"dormitory"`
+	AdminFee    float64           `bson:"admin_fee" json:"admin_fee"`
+	Adjustments []PriceAdjustment `bson:"adjustments" json:"adjustments"`
+	Total       float64           `bson:"total" json:"total"`
+	PromoCode   string            `bson:"promo_code,omitempty" json:"promo_code,omitempty"`
+	QuotedAt    time.Time         `bson:"quoted_at" json:"quoted_at"`
+}
+
+type PricingInput struct {
+	TenantID   string // dipakai untuk membaca harga program dari settings tenant
+	Student    *model.Student
+	PaymentFor int
+	PromoCode  string
+	Now        time.Time
+}
+
+type PricingService struct {
+	collection *mongo.Collection
+	cfg        *config.Config
+	settings   *SettingsService
+}
+
+func NewPricingService(db *database.Database, cfg *config.Config, settings *SettingsService) *PricingService {
+	return &PricingService{collection: db.DB.Collection(PricingRuleCollection), cfg: cfg, settings: settings}
+}
+
+// Program mengambil konfigurasi program berdasarkan program type siswa
+func (p *PricingService) Program(programType string) (config.ProgramConfig, bool) {
+	program, ok := p.cfg.Programs[programType]
+	return program, ok
+}
+
+// Quote menghitung harga untuk siswa dengan menerapkan semua aturan aktif yang cocok
+func (p *PricingService) Quote(ctx context.Context, in PricingInput) (*PriceQuote, error) {
+	if in.Student == nil || !in.Student.ProgramType.Valid {
+		return nil, ErrUnknownProgram
+	}
+
+	rules, err := p.ListRules(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.quote(in, rules)
+}
+
+// quote menghitung harga dari aturan yang sudah diurutkan berdasarkan prioritas
+func (p *PricingService) quote(in PricingInput, rules []PricingRule) (*PriceQuote, error) {
+	if in.Student == nil || !in.Student.ProgramType.Valid {
+		return nil, ErrUnknownProgram
+	}
+	if in.Now.IsZero() {
+		in.Now = time.Now()
+	}
+
+	programType := in.Student.ProgramType.String
+	program, ok := p.Program(programType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProgram, programType)
+	}
+	listPrice := program.Tuition
+	// harga dari settings tenant menggantikan harga di konfigurasi
+	if price := p.settings.Overrides(in.TenantID).ProgramPrices[programType]; price > 0 {
+		listPrice = price
+	}
+
+	quote := &PriceQuote{
+		ProgramType: programType,
+		ProgramName: program.Name,
+		PaymentFor:  in.PaymentFor,
+		ListPrice:   listPrice,
+		Total:       listPrice,
+		PromoCode:   strings.ToUpper(strings.TrimSpace(in.PromoCode)),
+		QuotedAt:    in.Now,
+	}
+
+	for _, rule := range rules {
+		if !rule.matches(in, programType, quote.PromoCode) {
+			continue
+		}
+
+		discount := rule.Amount
+		if rule.Percent > 0 {
+			discount = math.Round(listPrice * rule.Percent / 100)
+		}
+		// potongan hanya berlaku untuk biaya kursus, total tidak boleh negatif
+		discount = math.Min(discount, quote.Total)
+		if discount <= 0 {
+			continue
+		}
+
+		quote.Total -= discount
+		quote.Adjustments = append(quote.Adjustments, PriceAdjustment{
+			RuleID:      rule.ID.Hex(),
+			Rule:        rule.Type,
+			Description: rule.Name,
+			Amount:      -discount,
+		})
+	}
+
+	if wantsDormitory(in.Student) {
+		quote.Dormitory = program.DormitoryFee
+	}
+	if in.PaymentFor == 1 {
+		quote.AdminFee = program.AdminFee
+	}
+	quote.Total += quote.Dormitory + quote.AdminFee
+
+	return quote, nil
+}
+
+// wantsDormitory bernilai true jika siswa memilih tinggal di asrama
+func wantsDormitory(s *model.Student) bool {
+	if !s.Dormitory.Valid {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(s.Dormitory.String)) {
+	case "", "0", "no", "tidak", "false":
+		return false
+	}
+	return true
+}
+
+func (r PricingRule) matches(in PricingInput, programType string, promoCode string) bool {
+	if !r.Active {
+		return false
+	}
+	if r.PaymentFor != 0 && r.PaymentFor != in.PaymentFor {
+		return false
+	}
+	if len(r.ProgramTypes) > 0 && !containsString(r.ProgramTypes, programType) {
+		return false
+	}
+	if r.StartsAt != nil && in.Now.Before(*r.StartsAt) {
+		return false
+	}
+	if r.EndsAt != nil && in.Now.After(*r.EndsAt) {
+		return false
+	}
+
+	student := in.Student
+	switch r.Type {
+	case RuleReferral:
+		return student.ReferralID.Valid && student.ReferralID.String != ""
+	case RuleEarlyBird:
+		// early bird hanya dibatasi oleh periode StartsAt/EndsAt
+		return r.StartsAt != nil || r.EndsAt != nil
+	case RulePromoCode:
+		// kode promo yang ditetapkan ke siswa tertentu berlaku otomatis tanpa harus dimasukkan
+		if len(r.StudentIDs) > 0 && containsString(r.StudentIDs, student.ID) {
+			return true
+		}
+		return promoCode != "" && strings.EqualFold(r.Code, promoCode)
+	case RuleScholarship:
+		return containsString(r.StudentIDs, student.ID)
+	}
+	return false
+}
+
+// ListRules mengambil aturan harga urut berdasarkan prioritas
+func (p *PricingService) ListRules(ctx context.Context, activeOnly bool) ([]PricingRule, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["active"] = true
+	}
+
+	cur, err := p.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rules []PricingRule
+	if err := cur.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	sortRules(rules)
+	return rules, nil
+}
+
+// SaveRule membuat aturan baru atau mengganti aturan dengan ID yang sama
+func (p *PricingService) SaveRule(ctx context.Context, rule *PricingRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	rule.Code = strings.ToUpper(strings.TrimSpace(rule.Code))
+
+	if rule.ID.IsZero() {
+		rule.ID = primitive.NewObjectID()
+		rule.CreatedAt = time.Now()
+		_, err := p.collection.InsertOne(ctx, rule)
+		return err
+	}
+
+	// created_at tidak ikut diubah, aturan yang tidak ada tidak dibuat ulang
+	set := bson.M{
+		"type":          rule.Type,
+		"name":          rule.Name,
+		"code":          rule.Code,
+		"percent":       rule.Percent,
+		"amount":        rule.Amount,
+		"program_types": rule.ProgramTypes,
+		"payment_for":   rule.PaymentFor,
+		"student_ids":   rule.StudentIDs,
+		"starts_at":     rule.StartsAt,
+		"ends_at":       rule.EndsAt,
+		"priority":      rule.Priority,
+		"active":        rule.Active,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := p.collection.FindOneAndUpdate(ctx, bson.M{"_id": rule.ID}, bson.M{"$set": set}, opts).Decode(rule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrPricingRuleNotFound
+	}
+	return err
+}
+
+// DeleteRule menghapus aturan harga berdasarkan ID
+func (p *PricingService) DeleteRule(ctx context.Context, id primitive.ObjectID) error {
+	_, err := p.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// Validate memeriksa kelengkapan aturan sebelum disimpan
+func (r PricingRule) Validate() error {
+	switch r.Type {
+	case RuleReferral, RuleEarlyBird, RulePromoCode, RuleScholarship:
+	default:
+		return fmt.Errorf("invalid rule type %q", r.Type)
+	}
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.Percent < 0 || r.Percent > 100 {
+		return errors.New("percent must be between 0 and 100")
+	}
+	if r.Amount < 0 {
+		return errors.New("amount must not be negative")
+	}
+	if r.Percent == 0 && r.Amount == 0 {
+		return errors.New("either percent or amount is required")
+	}
+	if r.Type == RulePromoCode && r.Code == "" && len(r.StudentIDs) == 0 {
+		return errors.New("promo code rule requires code or student_ids")
+	}
+	if r.Type == RuleScholarship && len(r.StudentIDs) == 0 {
+		return errors.New("scholarship rule requires student_ids")
+	}
+	if r.Type == RuleEarlyBird && r.StartsAt == nil && r.EndsAt == nil {
+		return errors.New("early bird rule requires starts_at or ends_at")
+	}
+	return nil
+}
+
+func sortRules(rules []PricingRule) {
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testStudent(id, program string) *model.Student {
+	return &model.Student{ID: id, ProgramType: sql.NullString{String: program, Valid: program != ""}}
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+func TestPricingRuleMatches(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	referred := testStudent("s1", "kelas_akhir_pekan")
+	referred.ReferralID = sql.NullString{String: "ref-9", Valid: true}
+
+	tests := []struct {
+		name  string
+		rule  PricingRule
+		in    PricingInput
+		promo string
+		want  bool
+	}{
+		{"inactive rule", PricingRule{Type: RuleReferral}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", false},
+		{"referral", PricingRule{Type: RuleReferral, Active: true}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", true},
+		{"referral without referrer", PricingRule{Type: RuleReferral, Active: true}, PricingInput{Student: testStudent("s2", "kelas_akhir_pekan"), PaymentFor: 1, Now: now}, "", false},
+		{"other installment", PricingRule{Type: RuleReferral, Active: true, PaymentFor: 2}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", false},
+		{"other program", PricingRule{Type: RuleReferral, Active: true, ProgramTypes: []string{"kelas_senin_jumat_siang"}}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", false},
+		{"early bird in period", PricingRule{Type: RuleEarlyBird, Active: true, EndsAt: timePtr(now.Add(time.Hour))}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", true},
+		{"early bird expired", PricingRule{Type: RuleEarlyBird, Active: true, EndsAt: timePtr(now.Add(-time.Hour))}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", false},
+		{"early bird not started", PricingRule{Type: RuleEarlyBird, Active: true, StartsAt: timePtr(now.Add(time.Hour))}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", false},
+		{"promo code entered", PricingRule{Type: RulePromoCode, Active: true, Code: "HEMAT"}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "hemat", true},
+		{"promo code missing", PricingRule{Type: RulePromoCode, Active: true, Code: "HEMAT"}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", false},
+		{"promo assigned to student", PricingRule{Type: RulePromoCode, Active: true, Code: "HEMAT", StudentIDs: []string{"s1"}}, PricingInput{Student: referred, PaymentFor: 1, Now: now}, "", true},
+		{"scholarship", PricingRule{Type: RuleScholarship, Active: true, StudentIDs: []string{"s1"}}, PricingInput{Student: referred, PaymentFor: 2, Now: now}, "", true},
+		{"scholarship other student", PricingRule{Type: RuleScholarship, Active: true, StudentIDs: []string{"s3"}}, PricingInput{Student: referred, PaymentFor: 2, Now: now}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.in, tt.in.Student.ProgramType.String, tt.promo); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPricingServiceQuote(t *testing.T) {
+	cfg := &config.Config{Programs: map[string]config.ProgramConfig{
+		"kelas_akhir_pekan": {Name: "Kelas Akhir Pekan", Tuition: 6000000, DormitoryFee: 1500000, AdminFee: 250000},
+	}}
+	settings := &SettingsService{cfg: cfg, overrides: map[string]Settings{
+		"lpk_b": {TenantID: "lpk_b", ProgramPrices: map[string]float64{"kelas_akhir_pekan": 7000000}},
+	}}
+	p := &PricingService{cfg: cfg, settings: settings}
+
+	promoEnds := time.Date(2025, 3, 31, 23, 59, 0, 0, time.UTC)
+	rules := []PricingRule{
+		{ID: primitive.NewObjectID(), Type: RuleEarlyBird, Name: "Early bird", Percent: 10, EndsAt: &promoEnds, Active: true, Priority: 1},
+		{ID: primitive.NewObjectID(), Type: RuleScholarship, Name: "Beasiswa", Amount: 10000000, StudentIDs: []string{"full"}, Active: true, Priority: 2},
+	}
+
+	dorm := testStudent("s1", "kelas_akhir_pekan")
+	dorm.Dormitory = sql.NullString{String: "Ya", Valid: true}
+
+	tests := []struct {
+		name      string
+		in        PricingInput
+		wantTotal float64
+		wantAdj   int
+		wantErr   error
+	}{
+		{"first installment with admin fee", PricingInput{Student: testStudent("s1", "kelas_akhir_pekan"), PaymentFor: 1, Now: promoEnds.AddDate(0, 1, 0)}, 6250000, 0, nil},
+		{"second installment without admin fee", PricingInput{Student: testStudent("s1", "kelas_akhir_pekan"), PaymentFor: 2, Now: promoEnds.AddDate(0, 1, 0)}, 6000000, 0, nil},
+		{"dormitory fee", PricingInput{Student: dorm, PaymentFor: 2, Now: promoEnds.AddDate(0, 1, 0)}, 7500000, 0, nil},
+		{"percent discount in promo period", PricingInput{Student: testStudent("s1", "kelas_akhir_pekan"), PaymentFor: 2, Now: promoEnds.Add(-time.Hour)}, 5400000, 1, nil},
+		{"quote time before promo end keeps discount", PricingInput{Student: testStudent("s1", "kelas_akhir_pekan"), PaymentFor: 2, Now: promoEnds}, 5400000, 1, nil},
+		{"discount capped at tuition", PricingInput{Student: testStudent("full", "kelas_akhir_pekan"), PaymentFor: 1, Now: promoEnds.AddDate(0, 1, 0)}, 250000, 1, nil},
+		{"tenant price override", PricingInput{TenantID: "lpk_b", Student: testStudent("s1", "kelas_akhir_pekan"), PaymentFor: 2, Now: promoEnds.AddDate(0, 1, 0)}, 7000000, 0, nil},
+		{"unknown program", PricingInput{Student: testStudent("s1", "kelas_lain"), PaymentFor: 1}, 0, 0, ErrUnknownProgram},
+		{"student without program", PricingInput{Student: testStudent("s1", ""), PaymentFor: 1}, 0, 0, ErrUnknownProgram},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := p.quote(tt.in, rules)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("quote() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.Total != tt.wantTotal {
+				t.Errorf("Total = %v, want %v", quote.Total, tt.wantTotal)
+			}
+			if len(quote.Adjustments) != tt.wantAdj {
+				t.Errorf("Adjustments = %+v, want %d", quote.Adjustments, tt.wantAdj)
+			}
+			if !tt.in.Now.IsZero() && !quote.QuotedAt.Equal(tt.in.Now) {
+				t.Errorf("QuotedAt = %v, want %v", quote.QuotedAt, tt.in.Now)
+			}
+		})
+	}
+}
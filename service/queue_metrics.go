@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// ReconcileReportCollection menyimpan laporan dari subcommand reconcile
+const ReconcileReportCollection = "reconcile_reports"
+
+// queueMetricsTimeout membatasi lama query saat /metrics di-scrape
+const queueMetricsTimeout = 5 * time.Second
+
+// QueueMetrics menghitung gauge antrean dari MongoDB setiap kali /metrics di-scrape:
+// invoice yang masih menunggu pembayaran (kandidat reminder) dan selisih rekonsiliasi yang perlu dicek manual.
+type QueueMetrics struct {
+	ledger  *mongo.Collection
+	reports *mongo.Collection
+	log     *zap.Logger
+
+	pendingReminders *prometheus.Desc
+	reviewQueue      *prometheus.Desc
+}
+
+func NewQueueMetrics(db *database.Database, log *zap.Logger) *QueueMetrics {
+	return &QueueMetrics{
+		ledger:  db.DB.Collection(LedgerCollection),
+		reports: db.DB.Collection(ReconcileReportCollection),
+		log:     log,
+		pendingReminders: prometheus.NewDesc("pending_reminders",
+			"Invoice aktif yang belum dibayar per tenant.", []string{"tenant"}, nil),
+		reviewQueue: prometheus.NewDesc("review_queue_size",
+			"Selisih rekonsiliasi terakhir per tenant yang belum terselesaikan otomatis.", []string{"tenant"}, nil),
+	}
+}
+
+func (q *QueueMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.pendingReminders
+	ch <- q.reviewQueue
+}
+
+func (q *QueueMetrics) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueMetricsTimeout)
+	defer cancel()
+
+	pending, err := q.countPending(ctx)
+	if err != nil {
+		q.log.Error("Failed to count pending invoices", zap.Error(err))
+	}
+	for tenant, n := range pending {
+		ch <- prometheus.MustNewConstMetric(q.pendingReminders, prometheus.GaugeValue, float64(n), tenant)
+	}
+
+	review, err := q.countReview(ctx)
+	if err != nil {
+		q.log.Error("Failed to count review queue", zap.Error(err))
+	}
+	for tenant, n := range review {
+		ch <- prometheus.MustNewConstMetric(q.reviewQueue, prometheus.GaugeValue, float64(n), tenant)
+	}
+}
+
+// countPending menghitung entry ledger berstatus PENDING yang belum diganti invoice lain
+func (q *QueueMetrics) countPending(ctx context.Context) (map[string]int, error) {
+	cur, err := q.ledger.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": "PENDING", "replaced_by": bson.M{"$in": bson.A{nil, ""}}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$tenant_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rows []struct {
+		Tenant string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.Tenant] = r.Count
+	}
+	return counts, nil
+}
+
+// countReview menghitung selisih pada laporan rekonsiliasi terakhir tiap tenant yang gagal diproses
+// atau hanya dilaporkan (dry run)
+func (q *QueueMetrics) countReview(ctx context.Context) (map[string]int, error) {
+	cur, err := q.reports.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"finished_at": -1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$tenant_id", "discrepancies": bson.M{"$first": "$discrepancies"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rows []struct {
+		Tenant        string `bson:"_id"`
+		Discrepancies []struct {
+			Action string `bson:"action"`
+			Error  string `bson:"error"`
+		} `bson:"discrepancies"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		n := 0
+		for _, d := range r.Discrepancies {
+			if d.Error != "" || strings.HasPrefix(d.Action, "none") {
+				n++
+			}
+		}
+		counts[r.Tenant] = n
+	}
+	return counts, nil
+}
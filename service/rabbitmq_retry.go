@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/logger"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// Header pesan untuk retry
+const (
+	RetryCountHeader = "x-retry-count"
+	LastErrorHeader  = "x-last-error"
+)
+
+// RetryPolicy mengatur berapa kali pesan yang gagal diproses dicoba ulang sebelum masuk dead letter queue.
+// Jeda retry ke-n adalah BaseDelay * 2^(n-1), maksimal config.RabbitMqRetryDelayCap.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+// NewRetryPolicy membaca retry policy dari konfigurasi
+func NewRetryPolicy(cfg *config.Config) RetryPolicy {
+	policy := RetryPolicy{MaxRetries: 5, BaseDelay: 10 * time.Second}
+	if n, err := strconv.Atoi(cfg.RabbitMqMaxRetries); err == nil && n >= 0 && n <= config.RabbitMqRetryLimit {
+		policy.MaxRetries = n
+	}
+	if d, err := time.ParseDuration(cfg.RabbitMqRetryDelay); err == nil && d > 0 {
+		policy.BaseDelay = d
+	}
+	return policy
+}
+
+// Delay mengembalikan jeda untuk retry ke-n (mulai dari 1). Jeda digandakan tiap percobaan sampai
+// config.RabbitMqRetryDelayCap, sehingga retry terakhir berbagi queue retry yang sama.
+func (p RetryPolicy) Delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < config.RabbitMqRetryDelayCap; i++ {
+		d *= 2
+	}
+	if d > config.RabbitMqRetryDelayCap {
+		d = config.RabbitMqRetryDelayCap
+	}
+	return d
+}
+
+// retryQueueName adalah queue tunggu untuk retry dengan jeda delay, misalnya send_email.retry.40s.
+// Jeda ada di nama queue karena x-message-ttl tidak bisa diubah setelah queue dibuat: mengganti
+// RABBITMQ_RETRY_DELAY atau RABBITMQ_MAX_RETRIES cukup membuat queue baru, queue lama kosong dengan sendirinya.
+func retryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+// deadLetterQueueName menampung pesan yang ditolak consumer atau melebihi batas retry
+func deadLetterQueueName(queue string) string {
+	return queue + ".dead"
+}
+
+// declareTopology mendeklarasikan topic exchange notifikasi, queue utama dengan dead-letter ke <queue>.dead
+// yang di-bind ke exchange, serta satu queue retry per jeda yang mengembalikan pesan langsung ke queue utama
+// (bukan lewat exchange, agar consumer lain tidak menerima ulang). Karena dead-letter dipasang di queue utama,
+// Nack/Reject tanpa requeue dari consumer mana pun masuk ke <queue>.dead, bukan hilang.
+//
+// Queue utama yang dibuat versi lama tanpa argumen dead-letter membuat deklarasi gagal (PRECONDITION_FAILED).
+// Migrasinya: hentikan service dan email-worker, tunggu queue kosong, hapus queue
+// (rabbitmqctl delete_queue <queue>), lalu jalankan service lagi agar queue dibuat ulang dan di-bind.
+func (r *RabbitMQService) declareTopology(ch *amqp091.Channel) error {
+	if err := ch.ExchangeDeclare(r.exchange, amqp091.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %v", r.exchange, err)
+	}
+
+	dead := deadLetterQueueName(r.queueName)
+	if _, err := ch.QueueDeclare(dead, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead letter queue %s: %v", dead, err)
+	}
+
+	for n := 1; n <= r.retry.MaxRetries; n++ {
+		name := retryQueueName(r.queueName, r.retry.Delay(n))
+		_, err := ch.QueueDeclare(name, true, false, false, false, amqp091.Table{
+			"x-message-ttl":             r.retry.Delay(n).Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": r.queueName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue %s: %v", name, err)
+		}
+	}
+
+	_, err := ch.QueueDeclare(r.queueName, true, false, false, false, amqp091.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": dead,
+	})
+	if err != nil {
+		var amqpErr *amqp091.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.PreconditionFailed {
+			return fmt.Errorf("queue %s already exists without dead-letter arguments; stop the service and email-worker, "+
+				"wait until the queue is empty, delete it (rabbitmqctl delete_queue %s) and start again: %v", r.queueName, r.queueName, err)
+		}
+		return fmt.Errorf("failed to declare a queue: %v", err)
+	}
+
+	for _, key := range r.bindingKeys {
+		if err := ch.QueueBind(r.queueName, key, r.exchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue %s to %s with %s: %v", r.queueName, r.exchange, key, err)
+		}
+	}
+	return nil
+}
+
+// retryCount membaca header x-retry-count, nol jika belum pernah dicoba ulang
+func retryCount(headers amqp091.Table) int {
+	switch v := headers[RetryCountHeader].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// retryOrDeadLetter menjadwalkan ulang pesan yang gagal ke queue retry berikutnya,
+// atau menolaknya ke dead letter queue jika batas retry sudah tercapai
+func (r *RabbitMQService) retryOrDeadLetter(msg amqp091.Delivery, cause error) {
+	n := retryCount(msg.Headers) + 1
+	log := r.log.With(
+		zap.String("correlation_id", msg.CorrelationId),
+		zap.Int("retry", n),
+		zap.Error(cause))
+
+	headers := amqp091.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[LastErrorHeader] = logger.MaskPII(cause.Error())
+
+	if errors.Is(cause, ErrPermanent) {
+		log.Error("Message failed permanently, moving to dead letter queue")
+		r.deadLetter(msg, headers, log)
+		return
+	}
+	if n > r.retry.MaxRetries {
+		log.Error("Message exceeded retry limit, moving to dead letter queue")
+		r.deadLetter(msg, headers, log)
+		return
+	}
+
+	headers[RetryCountHeader] = int32(n)
+	err := r.publish(context.Background(), "", retryQueueName(r.queueName, r.retry.Delay(n)), amqp091.Publishing{
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp091.Persistent,
+		Type:          msg.Type,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Headers:       headers,
+		Body:          msg.Body,
+	})
+	if err != nil {
+		// pesan dikembalikan ke queue, channel biasanya sudah putus sehingga tidak terjadi loop
+		log.Error("Failed to schedule retry, requeueing message", zap.NamedError("publish_error", err))
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Warn("Message processing failed, retry scheduled", zap.Duration("delay", r.retry.Delay(n)))
+	msg.Ack(false)
+}
+
+// deadLetter memindahkan pesan ke dead letter queue beserta header x-last-error lalu meng-ack pesan aslinya.
+// Jika publish gagal, pesan di-nack tanpa requeue sehingga broker memindahkannya lewat dead-letter queue utama.
+func (r *RabbitMQService) deadLetter(msg amqp091.Delivery, headers amqp091.Table, log *zap.Logger) {
+	err := r.publish(context.Background(), "", deadLetterQueueName(r.queueName), amqp091.Publishing{
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp091.Persistent,
+		Type:          msg.Type,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Headers:       headers,
+		Body:          msg.Body,
+	})
+	if err != nil {
+		log.Error("Failed to move message to dead letter queue, rejecting it to the broker dead-letter exchange", zap.NamedError("publish_error", err))
+		msg.Nack(false, false)
+		return
+	}
+	msg.Ack(false)
+}
+
+// DeadLetter adalah ringkasan pesan di dead letter queue untuk endpoint admin dan CLI
+type DeadLetter struct {
+	MessageID     string `json:"message_id,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	ContentType   string `json:"content_type,omitempty"`
+	RetryCount    int    `json:"retry_count"`
+	LastError     string `json:"last_error,omitempty"`
+	Body          string `json:"body"`
+}
+
+// adminChannel membuka channel terpisah untuk operasi dead letter agar ack/nack-nya
+// tidak bercampur dengan consumer dan publisher di channel utama
+func (r *RabbitMQService) adminChannel(ctx context.Context) (*amqp091.Channel, error) {
+	if _, err := r.currentChannel(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	conn := r.conn
+	r.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	return ch, nil
+}
+
+// DeadLetters menampilkan maksimal limit pesan di dead letter queue tanpa mengeluarkannya;
+// pesan yang diambil dikembalikan ke queue saat channel ditutup
+func (r *RabbitMQService) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	ch, err := r.adminChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	letters := []DeadLetter{}
+	for len(letters) < limit {
+		msg, ok, err := ch.Get(deadLetterQueueName(r.queueName), false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letter queue: %v", err)
+		}
+		if !ok {
+			break
+		}
+		lastError, _ := msg.Headers[LastErrorHeader].(string)
+		letters = append(letters, DeadLetter{
+			MessageID:     msg.MessageId,
+			CorrelationID: msg.CorrelationId,
+			ContentType:   msg.ContentType,
+			RetryCount:    retryCount(msg.Headers),
+			LastError:     lastError,
+			Body:          string(msg.Body),
+		})
+	}
+	return letters, nil
+}
+
+// RequeueDeadLetters memindahkan maksimal limit pesan dari dead letter queue kembali ke queue utama
+// dengan hitungan retry direset, mengembalikan jumlah pesan yang dipindahkan
+func (r *RabbitMQService) RequeueDeadLetters(ctx context.Context, limit int) (int, error) {
+	ch, err := r.adminChannel(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	moved := 0
+	for moved < limit {
+		msg, ok, err := ch.Get(deadLetterQueueName(r.queueName), false)
+		if err != nil {
+			return moved, fmt.Errorf("failed to read dead letter queue: %v", err)
+		}
+		if !ok {
+			break
+		}
+
+		headers := amqp091.Table{}
+		for k, v := range msg.Headers {
+			if k != RetryCountHeader && k != LastErrorHeader && k != "x-death" {
+				headers[k] = v
+			}
+		}
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", r.queueName, false, false, amqp091.Publishing{
+			ContentType:   msg.ContentType,
+			DeliveryMode:  amqp091.Persistent,
+			Type:          msg.Type,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			Headers:       headers,
+			Body:          msg.Body,
+		})
+		if err != nil {
+			return moved, fmt.Errorf("failed to requeue message: %v", err)
+		}
+		if acked, err := confirm.WaitContext(ctx); err != nil || !acked {
+			return moved, fmt.Errorf("requeued message was not confirmed by broker: %v", err)
+		}
+		if err := msg.Ack(false); err != nil {
+			return moved, fmt.Errorf("failed to remove message from dead letter queue: %v", err)
+		}
+		moved++
+	}
+	return moved, nil
+}
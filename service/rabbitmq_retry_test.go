@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		n      int
+		want   time.Duration
+	}{
+		{"first retry", RetryPolicy{BaseDelay: 10 * time.Second}, 1, 10 * time.Second},
+		{"doubles", RetryPolicy{BaseDelay: 10 * time.Second}, 3, 40 * time.Second},
+		{"capped", RetryPolicy{BaseDelay: 10 * time.Second}, 10, time.Hour},
+		{"no overflow on large n", RetryPolicy{BaseDelay: 10 * time.Second}, 100, time.Hour},
+		{"base above cap", RetryPolicy{BaseDelay: 3 * time.Hour}, 1, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.n); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	// nilai di luar batas (yang juga ditolak Config.Validate) kembali ke default
+	for _, raw := range []string{"-1", "1000", "abc"} {
+		if got := NewRetryPolicy(&config.Config{RabbitMqMaxRetries: raw}).MaxRetries; got != 5 {
+			t.Errorf("MaxRetries for %q = %d, want default 5", raw, got)
+		}
+	}
+	if got := NewRetryPolicy(&config.Config{RabbitMqMaxRetries: "0"}).MaxRetries; got != 0 {
+		t.Errorf("MaxRetries for \"0\" = %d, want 0", got)
+	}
+}
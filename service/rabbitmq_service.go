@@ -3,73 +3,246 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sync"
+	"time"
+
+	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/metrics"
+	"webhook-listener-mekarisign/tracing"
 
 	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// Batas waktu publish (termasuk menunggu reconnect dan ack broker) serta backoff reconnect
+const (
+	rabbitMQPublishTimeout = 10 * time.Second
+	rabbitMQMinBackoff     = 1 * time.Second
+	rabbitMQMaxBackoff     = 30 * time.Second
 )
 
+// ErrRabbitMQClosed dikembalikan jika publish dilakukan setelah Close
+var ErrRabbitMQClosed = errors.New("rabbitmq service is closed")
+
+// RabbitMQService menjaga satu koneksi dan channel ke RabbitMQ. Jika broker restart,
+// koneksi dan channel dibuat ulang otomatis dengan backoff, dan publish menunggu sampai terhubung lagi.
 type RabbitMQService struct {
+	url         string
+	exchange    string
+	queueName   string
+	bindingKeys []string
+	retry       RetryPolicy
+	log         *zap.Logger
+
+	mu      sync.Mutex
 	conn    *amqp091.Connection
 	channel *amqp091.Channel
-	queue   amqp091.Queue
+	ready   chan struct{} // ditutup saat channel siap dipakai
+	done    chan struct{} // ditutup saat Close
+	once    sync.Once
+}
+
+// NewRabbitMQService membuat koneksi ke RabbitMQ, mendeklarasikan topic exchange notifikasi,
+// queue yang di-bind dengan bindingKeys, serta queue retry dan dead letter sesuai retry policy
+func NewRabbitMQService(url string, exchange string, queueName string, bindingKeys []string, retry RetryPolicy, log *zap.Logger) (*RabbitMQService, error) {
+	r := &RabbitMQService{
+		url:         url,
+		exchange:    exchange,
+		queueName:   queueName,
+		bindingKeys: bindingKeys,
+		retry:       retry,
+		log:         log,
+		ready:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
-// NewRabbitMQService membuat koneksi ke RabbitMQ
-func NewRabbitMQService(url string, queueName string) (*RabbitMQService, error) {
-	conn, err := amqp091.Dial(url)
+// connect membuka koneksi dan channel baru dalam mode publisher confirm lalu memantau penutupannya
+func (r *RabbitMQService) connect() error {
+	conn, err := amqp091.Dial(r.url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+		return fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open a channel: %v", err)
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %v", err)
 	}
 
-	q, err := ch.QueueDeclare(
-		queueName, // Nama queue
-		true,      // Durable
-		false,     // Auto-delete
-		false,     // Exclusive
-		false,     // No-wait
-		nil,       // Arguments
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to declare a queue: %v", err)
+	// Publish baru dianggap berhasil setelah broker mengirim ack
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+
+	if err := r.declareTopology(ch); err != nil {
+		conn.Close()
+		return err
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp091.Error, 1))
+
+	r.mu.Lock()
+	select {
+	case <-r.done:
+		// Close dipanggil saat reconnect sedang berjalan
+		r.mu.Unlock()
+		conn.Close()
+		return ErrRabbitMQClosed
+	default:
+	}
+	r.conn = conn
+	r.channel = ch
+	close(r.ready)
+	r.mu.Unlock()
+
+	go r.watch(conn, connClosed, chClosed)
+	return nil
+}
+
+// watch menunggu koneksi atau channel tertutup lalu menyambung ulang sampai berhasil atau Close dipanggil
+func (r *RabbitMQService) watch(conn *amqp091.Connection, connClosed, chClosed <-chan *amqp091.Error) {
+	var reason *amqp091.Error
+	select {
+	case <-r.done:
+		return
+	case reason = <-connClosed:
+	case reason = <-chClosed:
 	}
 
-	return &RabbitMQService{
-		conn:    conn,
-		channel: ch,
-		queue:   q,
-	}, nil
+	l := r.log
+	if reason != nil {
+		l.Warn("RabbitMQ connection lost, reconnecting", zap.String("reason", reason.Error()))
+	} else {
+		l.Warn("RabbitMQ connection lost, reconnecting")
+	}
+
+	r.mu.Lock()
+	r.channel = nil
+	r.ready = make(chan struct{})
+	r.mu.Unlock()
+	// Channel bisa tertutup sendiri (misalnya karena error protokol) sementara koneksinya masih hidup
+	conn.Close()
+
+	backoff := rabbitMQMinBackoff
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		if err := r.connect(); err != nil {
+			l.Warn("RabbitMQ reconnect failed", zap.Error(err), zap.Duration("retry_in", backoff))
+			backoff *= 2
+			if backoff > rabbitMQMaxBackoff {
+				backoff = rabbitMQMaxBackoff
+			}
+			continue
+		}
+		l.Info("Reconnected to RabbitMQ")
+		return
+	}
+}
+
+// currentChannel mengembalikan channel aktif, menunggu reconnect selesai jika koneksi sedang putus
+func (r *RabbitMQService) currentChannel(ctx context.Context) (*amqp091.Channel, error) {
+	for {
+		r.mu.Lock()
+		ch, ready := r.channel, r.ready
+		r.mu.Unlock()
+
+		select {
+		case <-r.done:
+			return nil, ErrRabbitMQClosed
+		default:
+		}
+		if ch != nil && !ch.IsClosed() {
+			return ch, nil
+		}
+
+		select {
+		case <-r.done:
+			return nil, ErrRabbitMQClosed
+		case <-ctx.Done():
+			return nil, fmt.Errorf("rabbitmq is not connected: %v", ctx.Err())
+		case <-ready:
+		}
+	}
 }
 
-// Publish mengirim pesan ke queue
-func (r *RabbitMQService) Publish(body string) error {
-	ctx := context.Background()
-	err := r.channel.PublishWithContext(
+// publish mengirim pesan ke exchange dengan routingKey dan menunggu konfirmasi broker.
+// Exchange kosong berarti default exchange, routingKey adalah nama queue.
+func (r *RabbitMQService) publish(ctx context.Context, exchange string, routingKey string, msg amqp091.Publishing) error {
+	ctx, cancel := context.WithTimeout(ctx, rabbitMQPublishTimeout)
+	defer cancel()
+
+	ch, err := r.currentChannel(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(
 		ctx,
-		"",           // Exchange
-		r.queue.Name, // Routing key (queue name)
-		false,        // Mandatory
-		false,        // Immediate
-		amqp091.Publishing{
-			ContentType: "text/plain",
-			Body:        []byte(body),
-		},
+		exchange,   // Exchange
+		routingKey, // Routing key
+		false,      // Mandatory
+		false,      // Immediate
+		msg,
 	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("no confirmation from broker: %v", err)
+	}
+	if !acked {
+		return errors.New("message was nacked by broker")
+	}
+	return nil
+}
+
+// Publish mengirim pesan teks ke exchange notifikasi dengan routing key tertentu
+func (r *RabbitMQService) Publish(ctx context.Context, routingKey string, body string) (err error) {
+	defer metrics.ObserveCall(metrics.RabbitMQ, "publish", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "rabbitmq.publish",
+		attribute.String("messaging.destination.name", r.exchange),
+		attribute.String("messaging.rabbitmq.destination.routing_key", routingKey))
+	defer tracing.End(span, &err)
+
+	err = r.publish(ctx, r.exchange, routingKey, amqp091.Publishing{
+		ContentType:   "text/plain",
+		DeliveryMode:  amqp091.Persistent,
+		CorrelationId: logger.CorrelationID(ctx),
+		Headers:       messageHeaders(ctx, MessageMeta{}),
+		Body:          []byte(body),
+	})
 	if err != nil {
 		return fmt.Errorf("failed to publish a message: %v", err)
 	}
-	log.Printf(" [x] Sent %s", body)
+	logger.FromContext(ctx).Debug("Message published", zap.String("routing_key", routingKey))
 	return nil
 }
 
-// PublishJSON mengirim data JSON ke queue
-func (r *RabbitMQService) PublishJSON(payload EmailPayload) error {
-	ctx := context.Background()
+// PublishJSON mengirim email JSON ke exchange notifikasi dengan routing key notify.email.<meta.Type>
+func (r *RabbitMQService) PublishJSON(ctx context.Context, meta MessageMeta, payload EmailPayload) (err error) {
+	routingKey := EmailRoutingKey(meta.Type)
+	defer metrics.ObserveCall(metrics.RabbitMQ, "publish", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "rabbitmq.publish",
+		attribute.String("messaging.destination.name", r.exchange),
+		attribute.String("messaging.rabbitmq.destination.routing_key", routingKey))
+	defer tracing.End(span, &err)
 
 	// Encode ke JSON
 	body, err := json.Marshal(payload)
@@ -77,62 +250,94 @@ func (r *RabbitMQService) PublishJSON(payload EmailPayload) error {
 		return fmt.Errorf("failed to encode JSON: %v", err)
 	}
 
-	err = r.channel.PublishWithContext(
-		ctx,
-		"",           // Exchange
-		r.queue.Name, // Routing key (queue name)
-		false,        // Mandatory
-		false,        // Immediate
-		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	err = r.publish(ctx, r.exchange, routingKey, amqp091.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp091.Persistent,
+		Type:          meta.Type,
+		CorrelationId: logger.CorrelationID(ctx),
+		Headers:       messageHeaders(ctx, meta),
+		Body:          body,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to publish message: %v", err)
 	}
 
-	log.Printf(" [x] Sent JSON: %s", body)
+	logger.FromContext(ctx).Debug("JSON message published", zap.String("routing_key", routingKey), zap.String("subject", payload.Subject))
 	return nil
 }
 
-// Consume menerima pesan dari queue dengan manual ack
-func (r *RabbitMQService) Consume() (<-chan amqp091.Delivery, error) {
-	msgs, err := r.channel.Consume(
-		r.queue.Name, // Queue
-		"",           // Consumer
-		false,        // Auto-ack diubah menjadi false
-		false,        // Exclusive
-		false,        // No-local
-		false,        // No-wait
-		nil,          // Args
+// Consume menerima pesan dari queue dengan manual ack. Saat ctx selesai consumer dibatalkan sehingga
+// tidak ada pesan baru, channel delivery ditutup setelah pesan yang sudah dikirim broker habis diproses.
+// Channel delivery juga tertutup saat koneksi putus; panggil Consume lagi setelah reconnect.
+func (r *RabbitMQService) Consume(ctx context.Context, prefetch int) (<-chan amqp091.Delivery, error) {
+	ch, err := r.currentChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return nil, fmt.Errorf("failed to set prefetch: %v", err)
+	}
+
+	tag := "consumer-" + logger.NewCorrelationID()
+	msgs, err := ch.Consume(
+		r.queueName, // Queue
+		tag,         // Consumer
+		false,       // Auto-ack diubah menjadi false
+		false,       // Exclusive
+		false,       // No-local
+		false,       // No-wait
+		nil,         // Args
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register a consumer: %v", err)
 	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ch.Cancel(tag, false)
+		case <-r.done:
+		}
+	}()
 	return msgs, nil
 }
 
-// ProcessMessages memproses pesan dari queue dengan rollback jika gagal
-func (r *RabbitMQService) ProcessMessages(msgs <-chan amqp091.Delivery) {
+// ProcessMessages memproses pesan dari queue dengan handle. Pesan yang gagal dijadwalkan ulang
+// lewat queue retry dengan jeda bertingkat, dan dipindah ke dead letter queue setelah MaxRetries.
+func (r *RabbitMQService) ProcessMessages(msgs <-chan amqp091.Delivery, handle func(amqp091.Delivery) error) {
 	for msg := range msgs {
-		log.Printf("Received message: %s", msg.Body)
-
-		// Simulasi error handling
-		if string(msg.Body) == "error" {
-			log.Println("Processing failed, rolling back...")
-			msg.Nack(false, true) // Kirim ulang pesan ke queue
+		if err := handle(msg); err != nil {
+			r.retryOrDeadLetter(msg, err)
 			continue
 		}
-
-		// Jika berhasil, ack pesan
 		msg.Ack(false)
-		log.Println("Message processed successfully")
 	}
 }
 
-// Close menutup koneksi RabbitMQ
+// Healthy mengembalikan error jika koneksi atau channel RabbitMQ sudah tertutup (misalnya sedang reconnect)
+func (r *RabbitMQService) Healthy() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil || r.conn.IsClosed() {
+		return errors.New("rabbitmq connection is closed")
+	}
+	if r.channel == nil || r.channel.IsClosed() {
+		return errors.New("rabbitmq channel is closed")
+	}
+	return nil
+}
+
+// Close menutup koneksi RabbitMQ dan menghentikan reconnect
 func (r *RabbitMQService) Close() {
-	r.channel.Close()
-	r.conn.Close()
+	r.once.Do(func() {
+		close(r.done)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.channel != nil {
+			r.channel.Close()
+		}
+		if r.conn != nil {
+			r.conn.Close()
+		}
+	})
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Ukuran halaman A4 dalam point
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+)
+
+// pdfPage menyusun content stream satu halaman PDF dengan font standar Helvetica,
+// cukup untuk dokumen sederhana seperti kuitansi tanpa library tambahan
+type pdfPage struct {
+	buf bytes.Buffer
+}
+
+// fillRect menggambar persegi panjang berwarna (r, g, b antara 0 dan 1)
+func (p *pdfPage) fillRect(x, y, w, h float64, r, g, b float64) {
+	fmt.Fprintf(&p.buf, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", r, g, b, x, y, w, h)
+}
+
+// line menggambar garis abu-abu tipis
+func (p *pdfPage) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.buf, "0.8 0.8 0.8 RG 0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// text menulis teks; bold memakai Helvetica-Bold, warna (r, g, b antara 0 dan 1)
+func (p *pdfPage) text(x, y float64, size float64, bold bool, r, g, b float64, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.buf, "BT %.3f %.3f %.3f rg /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", r, g, b, font, size, x, y, pdfString(s))
+}
+
+// textRight menulis teks rata kanan pada x, lebar teks diperkirakan dari lebar rata-rata Helvetica
+func (p *pdfPage) textRight(x, y float64, size float64, bold bool, s string) {
+	p.text(x-pdfTextWidth(s, size, bold), y, size, bold, 0, 0, 0, s)
+}
+
+// bytes menghasilkan file PDF lengkap: catalog, pages, page, dua font dan content stream
+func (p *pdfPage) bytes(title string) []byte {
+	content := p.buf.Bytes()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pdfPageWidth, pdfPageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		fmt.Sprintf("<< /Title (%s) /Producer (webhook-listener-mekarisign) >>", pdfString(title)),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return out.Bytes()
+}
+
+// pdfString meng-escape teks untuk literal string PDF dalam WinAnsiEncoding,
+// karakter di luar Latin-1 diganti "?"
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20:
+		case r < 0x80:
+			b.WriteRune(r)
+		case r < 0x100:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfTextWidth memperkirakan lebar teks dalam point
+func pdfTextWidth(s string, size float64, bold bool) float64 {
+	avg := 0.52
+	if bold {
+		avg = 0.56
+	}
+	return float64(len([]rune(s))) * size * avg
+}
@@ -0,0 +1,28 @@
+package service
+
+import "testing"
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain ascii", "Kuitansi Pembayaran", "Kuitansi Pembayaran"},
+		{"parentheses", "Cicilan (1)", `Cicilan \(1\)`},
+		{"backslash", `C:\tmp`, `C:\\tmp`},
+		{"unbalanced parenthesis", "a) b(", `a\) b\(`},
+		{"newline and tab", "baris\nbaru\tx\r", "baris baru x "},
+		{"control characters dropped", "a\x00b\x1fc", "abc"},
+		{"latin-1 as octal", "Café", `Caf\351`},
+		{"outside latin-1", "Rp 1.000 ✓", "Rp 1.000 ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfString(tt.in); got != tt.want {
+				t.Errorf("pdfString(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReceiptCollection        = "receipts"
+	ReceiptCounterCollection = "receipt_counters"
+)
+
+// Receipt adalah kuitansi pembayaran yang dikirim ke siswa. ID acak juga dipakai sebagai token
+// pada URL unduhan, sehingga kuitansi hanya bisa dibuka oleh yang menerima tautannya.
+type Receipt struct {
+	ID               string    `bson:"_id" json:"id"`
+	Number           string    `bson:"number" json:"number"`
+	TenantID         string    `bson:"tenant_id" json:"tenant_id"`
+	ExternalID       string    `bson:"external_id" json:"external_id"`
+	InvoiceID        string    `bson:"invoice_id" json:"invoice_id"`
+	PayerName        string    `bson:"payer_name" json:"payer_name"`
+	PayerEmail       string    `bson:"payer_email" json:"payer_email" log:"pii"`
+	Description      string    `bson:"description" json:"description"`
+	Amount           float64   `bson:"amount" json:"amount"`
+	PaymentMethod    string    `bson:"payment_method" json:"payment_method"`
+	RemainingBalance *float64  `bson:"remaining_balance,omitempty" json:"remaining_balance,omitempty"`
+	PaidAt           time.Time `bson:"paid_at" json:"paid_at"`
+	PDF              []byte    `bson:"pdf" json:"-"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+}
+
+// FileName adalah nama file PDF kuitansi, misalnya Kuitansi-KW-GOGLOBAL-2026-000012.pdf
+func (r *Receipt) FileName() string {
+	return "Kuitansi-" + strings.ReplaceAll(r.Number, "/", "-") + ".pdf"
+}
+
+// ReceiptInput adalah data pembayaran dari callback Xendit untuk membuat kuitansi
+type ReceiptInput struct {
+	Tenant           *config.Tenant
+	ExternalID       string
+	InvoiceID        string
+	PayerName        string
+	PayerEmail       string
+	Description      string
+	Amount           float64
+	PaymentMethod    string
+	PaymentChannel   string
+	PaidAt           time.Time
+	RemainingBalance *float64 // nil jika sisa pembayaran tidak diketahui
+}
+
+type ReceiptService struct {
+	receipts  *mongo.Collection
+	counters  *mongo.Collection
+	templates *TemplateRegistry
+	cfg       *config.Config
+}
+
+func NewReceiptService(db *database.Database, templates *TemplateRegistry, cfg *config.Config) *ReceiptService {
+	return &ReceiptService{
+		receipts:  db.DB.Collection(ReceiptCollection),
+		counters:  db.DB.Collection(ReceiptCounterCollection),
+		templates: templates,
+		cfg:       cfg,
+	}
+}
+
+// Issue membuat kuitansi untuk pembayaran, atau mengembalikan kuitansi yang sudah ada untuk external ID
+// yang sama sehingga callback yang dikirim ulang tidak menghasilkan nomor baru
+func (s *ReceiptService) Issue(ctx context.Context, in ReceiptInput) (*Receipt, error) {
+	existing, err := s.findOne(ctx, bson.M{"external_id": in.ExternalID})
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	if in.PaidAt.IsZero() {
+		in.PaidAt = time.Now()
+	}
+	number, err := s.nextNumber(ctx, in.Tenant.ID, in.PaidAt)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	method := in.PaymentMethod
+	if in.PaymentChannel != "" {
+		method = strings.TrimSpace(method + " - " + in.PaymentChannel)
+	}
+	r := &Receipt{
+		ID:               hex.EncodeToString(id),
+		Number:           number,
+		TenantID:         in.Tenant.ID,
+		ExternalID:       in.ExternalID,
+		InvoiceID:        in.InvoiceID,
+		PayerName:        in.PayerName,
+		PayerEmail:       in.PayerEmail,
+		Description:      in.Description,
+		Amount:           in.Amount,
+		PaymentMethod:    strings.ReplaceAll(method, "_", " "),
+		RemainingBalance: in.RemainingBalance,
+		PaidAt:           in.PaidAt,
+		CreatedAt:        time.Now(),
+	}
+	r.PDF = renderReceiptPDF(in.Tenant, r)
+
+	if _, err := s.receipts.InsertOne(ctx, r); err != nil {
+		// callback yang sama diproses bersamaan, pakai kuitansi yang tersimpan lebih dulu
+		if mongo.IsDuplicateKeyError(err) {
+			return s.findOne(ctx, bson.M{"external_id": in.ExternalID})
+		}
+		return nil, fmt.Errorf("failed to save receipt: %v", err)
+	}
+	return r, nil
+}
+
+// Find mengambil kuitansi berdasarkan ID, nil jika tidak ada
+func (s *ReceiptService) Find(ctx context.Context, id string) (*Receipt, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *ReceiptService) findOne(ctx context.Context, filter bson.M) (*Receipt, error) {
+	var r Receipt
+	err := s.receipts.FindOne(ctx, filter).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load receipt: %v", err)
+	}
+	return &r, nil
+}
+
+// nextNumber membuat nomor kuitansi berurutan per tenant per tahun: KW/<TENANT>/<TAHUN>/<URUTAN>
+func (s *ReceiptService) nextNumber(ctx context.Context, tenantID string, at time.Time) (string, error) {
+	year := at.In(jakarta()).Year()
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": fmt.Sprintf("%s:%d", tenantID, year)},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate receipt number: %v", err)
+	}
+	return fmt.Sprintf("KW/%s/%d/%06d", strings.ToUpper(tenantID), year, counter.Seq), nil
+}
+
+// AttachToStudent mencatat kuitansi di student_attachments bersama dokumen kontrak siswa.
+// URL memakai public_base_url, kosong berarti kuitansi tidak dicatat.
+func (s *ReceiptService) AttachToStudent(ctx context.Context, r *Receipt, studentID string) error {
+	if s.cfg.PublicBaseURL == "" {
+		return errors.New("public_base_url is not configured (PUBLIC_BASE_URL)")
+	}
+	now := time.Now()
+	_, err := model.CreateOrUpdateStudentAttachment(ctx, model.StudentAttachment{
+		ID:         r.ID,
+		StudentID:  sql.NullString{String: studentID, Valid: studentID != ""},
+		FileName:   r.FileName(),
+		FileURL:    s.URL(r),
+		UploadedAt: sql.NullTime{Time: now, Valid: true},
+		CreatedAt:  sql.NullTime{Time: now, Valid: true},
+		UpdatedAt:  sql.NullTime{Time: now, Valid: true},
+	})
+	return err
+}
+
+// URL adalah alamat unduhan PDF kuitansi
+func (s *ReceiptService) URL(r *Receipt) string {
+	return strings.TrimRight(s.cfg.PublicBaseURL, "/") + "/receipts/" + r.ID
+}
+
+// ReceiptEmail menyiapkan email kuitansi untuk siswa dengan PDF sebagai lampiran
+func (s *ReceiptService) ReceiptEmail(t *config.Tenant, r *Receipt) (EmailPayload, error) {
+	payload, err := s.templates.BuildEmail(t, r.PayerEmail, fmt.Sprintf("Kuitansi Pembayaran %s", t.Name), "template_send_email_receipt.html", TemplateData{
+		"RecipientName": r.PayerName,
+		"Number":        r.Number,
+		"Description":   r.Description,
+		"Amount":        r.Amount,
+		"PaidAt":        r.PaidAt,
+		"Tenant":        t.Name,
+	})
+	if err != nil {
+		return EmailPayload{}, err
+	}
+	payload.Attachments = []EmailAttachment{{
+		Filename:    r.FileName(),
+		ContentType: "application/pdf",
+		Content:     r.PDF,
+	}}
+	return payload, nil
+}
+
+// renderReceiptPDF membuat PDF kuitansi satu halaman dengan nama tenant sebagai kop
+func renderReceiptPDF(t *config.Tenant, r *Receipt) []byte {
+	var p pdfPage
+	const left, right = 56.0, pdfPageWidth - 56.0
+
+	// kop berwarna sama dengan tombol di template email
+	p.fillRect(0, pdfPageHeight-110, pdfPageWidth, 110, 0.231, 0.510, 0.965)
+	p.text(left, pdfPageHeight-62, 22, true, 1, 1, 1, t.Name)
+	p.text(left, pdfPageHeight-86, 11, false, 1, 1, 1, "Lembaga Pelatihan Kerja")
+
+	y := float64(pdfPageHeight - 160)
+	p.text(left, y, 18, true, 0, 0, 0, "KUITANSI PEMBAYARAN")
+	p.textRight(right, y, 11, false, r.Number)
+	y -= 18
+	p.line(left, y, right, y)
+
+	rows := [][2]string{
+		{"Nomor Kuitansi", r.Number},
+		{"Tanggal Pembayaran", FormatTanggalJam(r.PaidAt)},
+		{"Diterima dari", r.PayerName},
+		{"Email", r.PayerEmail},
+		{"Untuk Pembayaran", r.Description},
+		{"Metode Pembayaran", r.PaymentMethod},
+		{"ID Invoice", r.InvoiceID},
+	}
+	y -= 30
+	for _, row := range rows {
+		p.text(left, y, 11, false, 0.4, 0.4, 0.4, row[0])
+		p.text(left+150, y, 11, false, 0, 0, 0, row[1])
+		y -= 24
+	}
+
+	y -= 6
+	p.fillRect(left, y-14, right-left, 40, 0.976, 0.976, 0.976)
+	p.text(left+12, y, 13, true, 0, 0, 0, "Jumlah Dibayar")
+	p.textRight(right-12, y, 13, true, FormatRupiah(r.Amount))
+	y -= 48
+	if r.RemainingBalance != nil {
+		p.text(left+12, y, 11, false, 0.4, 0.4, 0.4, "Sisa Pembayaran")
+		p.textRight(right-12, y, 11, false, FormatRupiah(*r.RemainingBalance))
+		y -= 24
+	}
+
+	p.line(left, 90, right, 90)
+	p.text(left, 72, 9, false, 0.4, 0.4, 0.4, "Kuitansi ini dibuat secara elektronik dan sah tanpa tanda tangan.")
+	p.text(left, 58, 9, false, 0.4, 0.4, 0.4, fmt.Sprintf("Dicetak %s", FormatTanggalJam(r.CreatedAt)))
+
+	return p.bytes(fmt.Sprintf("Kuitansi %s", r.Number))
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// ErrSettingsConflict berarti pengaturan diubah oleh request lain sejak dibaca, perubahan harus diulang
+var ErrSettingsConflict = errors.New("settings were changed by another request, reload and try again")
+
+// SettingsValidationError adalah kesalahan pada isi perubahan, bukan pada penyimpanan
+type SettingsValidationError struct{ msg string }
+
+func (e *SettingsValidationError) Error() string { return e.msg }
+
+func invalidSettings(format string, args ...interface{}) error {
+	return &SettingsValidationError{msg: fmt.Sprintf(format, args...)}
+}
+
+const (
+	SettingsCollection      = "settings"
+	SettingsAuditCollection = "settings_audit"
+)
+
+// Settings adalah pengaturan bisnis per tenant yang bisa diubah tanpa restart.
+// Field kosong berarti memakai nilai dari konfigurasi.
+type Settings struct {
+	TenantID                   string             `bson:"_id" json:"tenant_id"`
+	InvoiceDuration            string             `bson:"invoice_duration,omitempty" json:"invoice_duration,omitempty"`
+	WhatsappTemplateID         string             `bson:"whatsapp_template_id,omitempty" json:"whatsapp_template_id,omitempty"`
+	WhatsappNotificationNumber string             `bson:"whatsapp_notification_number,omitempty" json:"whatsapp_notification_number,omitempty"`
+	ProgramPrices              map[string]float64 `bson:"program_prices,omitempty" json:"program_prices,omitempty"`
+	SecondPaymentDeadline      *time.Time         `bson:"second_payment_deadline,omitempty" json:"second_payment_deadline,omitempty"`
+	Version                    int64              `bson:"version" json:"version"`
+	UpdatedAt                  time.Time          `bson:"updated_at" json:"updated_at"`
+	UpdatedBy                  string             `bson:"updated_by" json:"updated_by"`
+}
+
+// SettingsUpdate berisi perubahan sebagian. Field nil tidak diubah, string kosong menghapus override,
+// dan harga 0 menghapus override harga program tersebut.
+type SettingsUpdate struct {
+	InvoiceDuration            *string            `json:"invoice_duration"`
+	WhatsappTemplateID         *string            `json:"whatsapp_template_id"`
+	WhatsappNotificationNumber *string            `json:"whatsapp_notification_number"`
+	ProgramPrices              map[string]float64 `json:"program_prices"`
+	SecondPaymentDeadline      *string            `json:"second_payment_deadline"` // RFC3339
+	Version                    *int64             `json:"version"`                 // opsional, ditolak jika pengaturan sudah diubah orang lain
+}
+
+// SettingsChange adalah satu field yang berubah dalam audit trail
+type SettingsChange struct {
+	Field string      `bson:"field" json:"field"`
+	Old   interface{} `bson:"old" json:"old"`
+	New   interface{} `bson:"new" json:"new"`
+}
+
+type SettingsAudit struct {
+	TenantID  string           `bson:"tenant_id" json:"tenant_id"`
+	ChangedBy string           `bson:"changed_by" json:"changed_by"`
+	ChangedAt time.Time        `bson:"changed_at" json:"changed_at"`
+	Changes   []SettingsChange `bson:"changes" json:"changes"`
+}
+
+type SettingsService struct {
+	collection *mongo.Collection
+	audit      *mongo.Collection
+	cfg        *config.Config
+	log        *zap.Logger
+
+	mu        sync.RWMutex
+	overrides map[string]Settings
+}
+
+func NewSettingsService(db *database.Database, cfg *config.Config, log *zap.Logger) *SettingsService {
+	return &SettingsService{
+		collection: db.DB.Collection(SettingsCollection),
+		audit:      db.DB.Collection(SettingsAuditCollection),
+		cfg:        cfg,
+		log:        log,
+		overrides:  map[string]Settings{},
+	}
+}
+
+// Reload membaca ulang semua pengaturan dari MongoDB
+func (s *SettingsService) Reload(ctx context.Context) error {
+	cur, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var all []Settings
+	if err := cur.All(ctx, &all); err != nil {
+		return err
+	}
+
+	overrides := make(map[string]Settings, len(all))
+	for _, st := range all {
+		overrides[st.TenantID] = st
+	}
+
+	s.mu.Lock()
+	s.overrides = overrides
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch memuat ulang pengaturan secara berkala sampai ctx selesai, sehingga perubahan
+// langsung di database juga terbaca tanpa restart
+func (s *SettingsService) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(ctx); err != nil {
+				s.log.Error("Failed to reload settings", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Overrides mengembalikan nilai yang tersimpan di database tanpa fallback ke konfigurasi
+func (s *SettingsService) Overrides(tenantID string) Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, ok := s.overrides[tenantID]
+	if !ok {
+		return Settings{TenantID: tenantID}
+	}
+	return st
+}
+
+// Get mengembalikan pengaturan efektif tenant: nilai dari database, atau dari konfigurasi jika tidak diisi
+func (s *SettingsService) Get(t *config.Tenant) Settings {
+	st := s.Overrides(t.ID)
+
+	if st.InvoiceDuration == "" {
+		st.InvoiceDuration = s.cfg.XenditInvDuration
+	}
+	if st.WhatsappTemplateID == "" {
+		st.WhatsappTemplateID = t.WhatsappTemplateID
+	}
+	if st.WhatsappNotificationNumber == "" {
+		st.WhatsappNotificationNumber = t.WhatsappNotificationNumber
+	}
+
+	prices := make(map[string]float64, len(s.cfg.Programs))
+	for key, p := range s.cfg.Programs {
+		prices[key] = p.Tuition
+	}
+	for key, price := range st.ProgramPrices {
+		prices[key] = price
+	}
+	st.ProgramPrices = prices
+
+	return st
+}
+
+// current membaca pengaturan tenant langsung dari MongoDB, bukan dari cache yang bisa tertinggal
+func (s *SettingsService) current(ctx context.Context, tenantID string) (Settings, error) {
+	var st Settings
+	err := s.collection.FindOne(ctx, bson.M{"_id": tenantID}).Decode(&st)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Settings{TenantID: tenantID}, nil
+	}
+	return st, err
+}
+
+// Update menerapkan perubahan per field ($set/$unset) dengan syarat versi dokumen belum berubah sejak dibaca,
+// sehingga dua admin yang mengubah field berbeda tidak saling menimpa. Audit trail mencatat nilai lama dari database.
+func (s *SettingsService) Update(ctx context.Context, tenantID string, upd SettingsUpdate, actor string) (Settings, error) {
+	if err := s.validate(upd); err != nil {
+		return Settings{}, err
+	}
+	old, err := s.current(ctx, tenantID)
+	if err != nil {
+		return Settings{}, err
+	}
+	if upd.Version != nil && *upd.Version != old.Version {
+		return old, ErrSettingsConflict
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	var changes []SettingsChange
+	setString := func(field string, current string, value *string) {
+		if value == nil || *value == current {
+			return
+		}
+		changes = append(changes, SettingsChange{Field: field, Old: current, New: *value})
+		if *value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = *value
+		}
+	}
+
+	setString("invoice_duration", old.InvoiceDuration, upd.InvoiceDuration)
+	setString("whatsapp_template_id", old.WhatsappTemplateID, upd.WhatsappTemplateID)
+	setString("whatsapp_notification_number", old.WhatsappNotificationNumber, upd.WhatsappNotificationNumber)
+
+	for program, price := range upd.ProgramPrices {
+		if current := old.ProgramPrices[program]; current != price {
+			field := "program_prices." + program
+			changes = append(changes, SettingsChange{Field: field, Old: current, New: price})
+			if price == 0 {
+				unset[field] = ""
+			} else {
+				set[field] = price
+			}
+		}
+	}
+
+	if upd.SecondPaymentDeadline != nil {
+		var deadline *time.Time
+		if *upd.SecondPaymentDeadline != "" {
+			t, _ := time.Parse(time.RFC3339, *upd.SecondPaymentDeadline) // sudah diperiksa oleh validate
+			deadline = &t
+		}
+		if !sameTime(old.SecondPaymentDeadline, deadline) {
+			changes = append(changes, SettingsChange{Field: "second_payment_deadline", Old: old.SecondPaymentDeadline, New: deadline})
+			if deadline == nil {
+				unset["second_payment_deadline"] = ""
+			} else {
+				set["second_payment_deadline"] = *deadline
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		return old, nil
+	}
+
+	now := time.Now()
+	set["updated_at"] = now
+	set["updated_by"] = actor
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// Dokumen lama tanpa field version dianggap versi 0. Jika versi sudah berubah, upsert mencoba
+	// membuat dokumen baru dengan _id yang sama dan gagal dengan duplicate key.
+	filter := bson.M{"_id": tenantID, "version": old.Version}
+	if old.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var next Settings
+	if err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&next); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return old, ErrSettingsConflict
+		}
+		return old, err
+	}
+
+	audit := SettingsAudit{TenantID: tenantID, ChangedBy: actor, ChangedAt: now, Changes: changes}
+	if _, err := s.audit.InsertOne(ctx, audit); err != nil {
+		logger.FromContext(ctx).Error("Failed to write settings audit", zap.Error(err))
+	}
+
+	s.mu.Lock()
+	s.overrides[tenantID] = next
+	s.mu.Unlock()
+
+	return next, nil
+}
+
+// validate memeriksa isi perubahan sebelum pengaturan dibaca dari database. String kosong menghapus
+// override sehingga tidak divalidasi.
+func (s *SettingsService) validate(upd SettingsUpdate) error {
+	if upd.InvoiceDuration != nil && *upd.InvoiceDuration != "" {
+		if n, err := strconv.ParseUint(*upd.InvoiceDuration, 10, 64); err != nil || n == 0 {
+			return invalidSettings("invoice_duration must be a positive number of seconds")
+		}
+	}
+	if upd.WhatsappNotificationNumber != nil {
+		if msg := config.CheckValue(*upd.WhatsappNotificationNumber, "phone"); msg != "" {
+			return invalidSettings("whatsapp_notification_number %s", msg)
+		}
+	}
+	for program, price := range upd.ProgramPrices {
+		if _, ok := s.cfg.Programs[program]; !ok {
+			return invalidSettings("unknown program %q", program)
+		}
+		if price < 0 {
+			return invalidSettings("price for %q must not be negative", program)
+		}
+	}
+	if upd.SecondPaymentDeadline != nil && *upd.SecondPaymentDeadline != "" {
+		if _, err := time.Parse(time.RFC3339, *upd.SecondPaymentDeadline); err != nil {
+			return invalidSettings("second_payment_deadline must be in RFC3339 format")
+		}
+	}
+	return nil
+}
+
+// AuditLog mengambil riwayat perubahan pengaturan tenant, terbaru lebih dulu
+func (s *SettingsService) AuditLog(ctx context.Context, tenantID string, limit int64) ([]SettingsAudit, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "changed_at", Value: -1}}).SetLimit(limit)
+	cur, err := s.audit.Find(ctx, bson.M{"tenant_id": tenantID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var entries []SettingsAudit
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"webhook-listener-mekarisign/config"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestSettingsValidate(t *testing.T) {
+	s := &SettingsService{cfg: &config.Config{Programs: map[string]config.ProgramConfig{"kelas_akhir_pekan": {Tuition: 6000000}}}}
+
+	tests := []struct {
+		name    string
+		upd     SettingsUpdate
+		wantErr bool
+	}{
+		{"empty update", SettingsUpdate{}, false},
+		{"valid phone", SettingsUpdate{WhatsappNotificationNumber: strPtr("+6281234567890")}, false},
+		{"clearing phone override", SettingsUpdate{WhatsappNotificationNumber: strPtr("")}, false},
+		{"local phone format", SettingsUpdate{WhatsappNotificationNumber: strPtr("081234567890")}, true},
+		{"phone placeholder", SettingsUpdate{WhatsappNotificationNumber: strPtr("628xxxxxxxxxx")}, true},
+		{"zero invoice duration", SettingsUpdate{InvoiceDuration: strPtr("0")}, true},
+		{"unknown program", SettingsUpdate{ProgramPrices: map[string]float64{"kelas_x": 1000}}, true},
+		{"negative price", SettingsUpdate{ProgramPrices: map[string]float64{"kelas_akhir_pekan": -1}}, true},
+		{"deadline not RFC3339", SettingsUpdate{SecondPaymentDeadline: strPtr("2025-03-10")}, true},
+		{"valid deadline", SettingsUpdate{SecondPaymentDeadline: strPtr("2025-03-10T09:00:00+07:00")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validate(tt.upd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var invalid *SettingsValidationError
+			if err != nil && !errors.As(err, &invalid) {
+				t.Errorf("validate() error %T is not a SettingsValidationError", err)
+			}
+		})
+	}
+}
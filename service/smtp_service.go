@@ -0,0 +1,316 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/metrics"
+	"webhook-listener-mekarisign/tracing"
+)
+
+// smtpTimeout membatasi satu sesi SMTP jika ctx tidak punya deadline
+const smtpTimeout = 30 * time.Second
+
+// ErrPermanent menandai kegagalan yang tidak akan berhasil jika dicoba ulang (misalnya alamat ditolak server),
+// pesan seperti ini langsung dipindah ke dead letter queue
+var ErrPermanent = errors.New("permanent failure")
+
+// PermanentError membungkus err agar errors.Is(err, ErrPermanent) bernilai true
+func PermanentError(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// RejectedRecipient adalah alamat cc/bcc yang ditolak permanen server SMTP saat email tetap dikirim ke penerima utama
+type RejectedRecipient struct {
+	Address string
+	Err     error
+}
+
+// SMTPMailer mengirim EmailPayload lewat server SMTP dengan STARTTLS, TLS langsung, atau tanpa TLS
+type SMTPMailer struct {
+	host     string
+	port     string
+	user     string
+	password string
+	from     string
+	tlsMode  string
+}
+
+func NewSMTPMailer(cfg *config.Config) (*SMTPMailer, error) {
+	if cfg.SMTPHost == "" {
+		return nil, errors.New("smtp_host is required (SMTP_HOST)")
+	}
+	if cfg.SMTPFrom == "" {
+		return nil, errors.New("smtp_from is required (SMTP_FROM)")
+	}
+	return &SMTPMailer{
+		host:     cfg.SMTPHost,
+		port:     cfg.SMTPPort,
+		user:     cfg.SMTPUser,
+		password: cfg.SMTPPassword,
+		from:     cfg.SMTPFrom,
+		tlsMode:  cfg.SMTPTLS,
+	}, nil
+}
+
+// Send mengirim satu email. Penolakan permanen dari server (kode 5xx) dikembalikan sebagai PermanentError,
+// kecuali penolakan alamat cc/bcc yang dikembalikan di rejected sementara email tetap dikirim ke penerima utama.
+func (m *SMTPMailer) Send(ctx context.Context, payload EmailPayload) (rejected []RejectedRecipient, err error) {
+	defer metrics.ObserveCall(metrics.SMTP, "send_mail", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "smtp.SendMail")
+	defer tracing.End(span, &err)
+
+	to, err := mail.ParseAddress(payload.To)
+	if err != nil {
+		return nil, PermanentError(fmt.Errorf("invalid recipient %q: %v", payload.To, err))
+	}
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return nil, PermanentError(fmt.Errorf("invalid sender %q: %v", m.from, err))
+	}
+
+	var copies []string
+	for _, addr := range append(append([]string{}, payload.Cc...), payload.Bcc...) {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, PermanentError(fmt.Errorf("invalid cc/bcc %q: %v", addr, err))
+		}
+		copies = append(copies, a.Address)
+	}
+
+	msg, err := buildMessage(from, to, payload)
+	if err != nil {
+		return nil, PermanentError(err)
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if m.user != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.user, m.password, m.host)); err != nil {
+			return nil, smtpError("authenticate", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return nil, smtpError("MAIL FROM", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return nil, smtpError("RCPT TO", err)
+	}
+	// penolakan permanen untuk cc/bcc tidak menggagalkan email ke penerima utama
+	for _, rcpt := range copies {
+		if err := client.Rcpt(rcpt); err != nil {
+			err = smtpError("RCPT TO", err)
+			if !errors.Is(err, ErrPermanent) {
+				return nil, err
+			}
+			rejected = append(rejected, RejectedRecipient{Address: rcpt, Err: err})
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return rejected, smtpError("DATA", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return rejected, smtpError("DATA", err)
+	}
+	if err := w.Close(); err != nil {
+		return rejected, smtpError("DATA", err)
+	}
+	return rejected, client.Quit()
+}
+
+// dial membuka sesi SMTP sesuai mode TLS, dengan deadline dari ctx
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	addr := net.JoinHostPort(m.host, m.port)
+	tlsConfig := &tls.Config{ServerName: m.host}
+
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	conn.SetDeadline(deadline)
+	if m.tlsMode == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	if m.tlsMode == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	return client, nil
+}
+
+// smtpError menandai balasan 5xx sebagai permanen, 4xx dan error jaringan tetap bisa dicoba ulang
+func smtpError(step string, err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return PermanentError(fmt.Errorf("%s rejected: %w", step, err))
+	}
+	return fmt.Errorf("%s failed: %w", step, err)
+}
+
+// SMTPCode mengambil kode balasan SMTP dari err, 0 jika bukan balasan server
+func SMTPCode(err error) int {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	return 0
+}
+
+// buildMessage menyusun pesan MIME: body html/text (multipart/alternative jika ada versi plain text)
+// dan lampiran dalam multipart/mixed. Bcc tidak ditulis ke header.
+func buildMessage(from, to *mail.Address, payload EmailPayload) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+
+	header("From", from.String())
+	header("To", to.String())
+	if len(payload.Cc) > 0 {
+		header("Cc", strings.Join(payload.Cc, ", "))
+	}
+	if payload.ReplyTo != "" {
+		header("Reply-To", payload.ReplyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", payload.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	bodyHeader, body, err := bodyEntity(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload.Attachments) == 0 {
+		for k, v := range bodyHeader {
+			header(k, v[0])
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", mw.Boundary()))
+	buf.WriteString("\r\n")
+
+	part, err := mw.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(body)
+
+	for _, a := range payload.Attachments {
+		ct := a.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		name := mime.QEncoding.Encode("utf-8", a.Filename)
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; name=%q", ct, name)},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Content)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// bodyEntity mengembalikan header dan isi bagian body: satu part html/text, atau multipart/alternative
+// berisi plain text dan html jika payload.Text diisi
+func bodyEntity(payload EmailPayload) (textproto.MIMEHeader, []byte, error) {
+	contentType := "text/html; charset=UTF-8"
+	if payload.Format == "text" {
+		contentType = "text/plain; charset=UTF-8"
+	}
+
+	if payload.Text == "" || payload.Format == "text" {
+		var body bytes.Buffer
+		writeBase64(&body, []byte(payload.Msg))
+		return textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		}, body.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	aw := multipart.NewWriter(&body)
+	for _, alt := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", payload.Text},
+		{contentType, payload.Msg},
+	} {
+		part, err := aw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {alt.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		writeBase64(part, []byte(alt.content))
+	}
+	if err := aw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", aw.Boundary())},
+	}, body.Bytes(), nil
+}
+
+// writeBase64 menulis data base64 dengan baris maksimal 76 karakter sesuai RFC 2045
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+func messageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
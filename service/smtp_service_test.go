@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"webhook-listener-mekarisign/config"
+)
+
+// smtpStub adalah server SMTP lokal minimal untuk menguji SMTPMailer tanpa server sungguhan.
+// Alamat di replies menentukan balasan RCPT TO, alamat lain diterima dengan 250.
+type smtpStub struct {
+	listener net.Listener
+	replies  map[string]string
+	rcpts    chan []string
+	data     chan string
+}
+
+func newSMTPStub(t *testing.T, replies map[string]string) *smtpStub {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{listener: l, replies: replies, rcpts: make(chan []string, 1), data: make(chan string, 1)}
+	t.Cleanup(func() { l.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpStub) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	var rcpts []string
+	tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			tp.PrintfLine("250 stub")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			addr := strings.Trim(line[len("RCPT TO:"):], "<> ")
+			if reply, ok := s.replies[addr]; ok {
+				tp.PrintfLine("%s", reply)
+				continue
+			}
+			rcpts = append(rcpts, addr)
+			tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			body, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.rcpts <- rcpts
+			s.data <- string(body)
+			tp.PrintfLine("250 OK queued")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	tests := []struct {
+		name          string
+		replies       map[string]string
+		cc            []string
+		bcc           []string
+		wantRcpts     []string
+		wantRejected  []string
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{
+			name:      "all recipients accepted",
+			cc:        []string{"cc@example.com"},
+			bcc:       []string{"bcc@example.com"},
+			wantRcpts: []string{"budi@example.com", "cc@example.com", "bcc@example.com"},
+		},
+		{
+			name:         "cc rejected permanently is a partial failure",
+			replies:      map[string]string{"gone@example.com": "550 No such user"},
+			cc:           []string{"gone@example.com"},
+			bcc:          []string{"bcc@example.com"},
+			wantRcpts:    []string{"budi@example.com", "bcc@example.com"},
+			wantRejected: []string{"gone@example.com"},
+		},
+		{
+			name:          "primary rejected permanently",
+			replies:       map[string]string{"budi@example.com": "550 No such user"},
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:    "cc rejected temporarily is retried",
+			replies: map[string]string{"busy@example.com": "451 Try again later"},
+			cc:      []string{"busy@example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSMTPStub(t, tt.replies)
+			host, port, _ := net.SplitHostPort(stub.listener.Addr().String())
+			mailer, err := NewSMTPMailer(&config.Config{SMTPHost: host, SMTPPort: port, SMTPFrom: "no-reply@go-global.id", SMTPTLS: "none"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rejected, err := mailer.Send(context.Background(), EmailPayload{
+				To: "budi@example.com", Cc: tt.cc, Bcc: tt.bcc, Subject: "Tes", Format: "html", Msg: "<p>Halo</p>",
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrPermanent) != tt.wantPermanent {
+				t.Errorf("Send() error = %v, want permanent %v", err, tt.wantPermanent)
+			}
+
+			var gotRejected []string
+			for _, r := range rejected {
+				gotRejected = append(gotRejected, r.Address)
+				if SMTPCode(r.Err) != 550 {
+					t.Errorf("rejected %s code = %d, want 550", r.Address, SMTPCode(r.Err))
+				}
+			}
+			if strings.Join(gotRejected, ",") != strings.Join(tt.wantRejected, ",") {
+				t.Errorf("rejected = %v, want %v", gotRejected, tt.wantRejected)
+			}
+
+			if tt.wantErr {
+				return
+			}
+			if got := <-stub.rcpts; strings.Join(got, ",") != strings.Join(tt.wantRcpts, ",") {
+				t.Errorf("delivered to %v, want %v", got, tt.wantRcpts)
+			}
+			if data := <-stub.data; strings.Contains(data, "bcc@example.com") {
+				t.Error("Bcc address leaked into the message")
+			}
+		})
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	from := &mail.Address{Name: "Go Global", Address: "no-reply@go-global.id"}
+	to := &mail.Address{Name: "Budi", Address: "budi@example.com"}
+
+	tests := []struct {
+		name      string
+		payload   EmailPayload
+		wantType  string
+		wantParts []string // Content-Type tiap part tingkat pertama
+	}{
+		{
+			name:     "html only",
+			payload:  EmailPayload{Subject: "Invoice", Format: "html", Msg: "<p>Halo</p>"},
+			wantType: "text/html",
+		},
+		{
+			name:     "plain text",
+			payload:  EmailPayload{Subject: "Invoice", Format: "text", Msg: "Halo", Text: "ignored"},
+			wantType: "text/plain",
+		},
+		{
+			name:      "html with text alternative",
+			payload:   EmailPayload{Subject: "Invoice", Format: "html", Msg: "<p>Halo</p>", Text: "Halo"},
+			wantType:  "multipart/alternative",
+			wantParts: []string{"text/plain", "text/html"},
+		},
+		{
+			name: "attachment",
+			payload: EmailPayload{Subject: "Kuitansi", Format: "html", Msg: "<p>Halo</p>", Cc: []string{"cc@example.com"}, Bcc: []string{"bcc@example.com"},
+				Attachments: []EmailAttachment{{Filename: "kuitansi.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4")}}},
+			wantType:  "multipart/mixed",
+			wantParts: []string{"text/html", "application/pdf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := buildMessage(from, to, tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+			if err != nil {
+				t.Fatalf("invalid message: %v", err)
+			}
+
+			if got := msg.Header.Get("To"); got != to.String() {
+				t.Errorf("To = %q, want %q", got, to.String())
+			}
+			if got := msg.Header.Get("Cc"); got != strings.Join(tt.payload.Cc, ", ") {
+				t.Errorf("Cc = %q", got)
+			}
+			if msg.Header.Get("Bcc") != "" || strings.Contains(string(raw), "bcc@example.com") {
+				t.Error("Bcc must not be written to the message")
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil || subject != tt.payload.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.payload.Subject)
+			}
+
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			if err != nil || mediaType != tt.wantType {
+				t.Fatalf("Content-Type = %q (%v), want %s", mediaType, err, tt.wantType)
+			}
+			if len(tt.wantParts) == 0 {
+				return
+			}
+
+			mr := multipart.NewReader(msg.Body, params["boundary"])
+			var parts []string
+			for {
+				p, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+				parts = append(parts, ct)
+			}
+			if strings.Join(parts, ",") != strings.Join(tt.wantParts, ",") {
+				t.Errorf("parts = %v, want %v", parts, tt.wantParts)
+			}
+		})
+	}
+}
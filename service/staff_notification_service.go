@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/database"
+	"webhook-listener-mekarisign/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	StaffDigestCollection    = "staff_digest"
+	StaffDigestRunCollection = "staff_digest_runs"
+)
+
+// staffDigestLease adalah lama satu replica memegang digest sebuah tenant, event dan tanggal.
+// Jika replica mati sebelum selesai, replica lain boleh mengirim setelah lease habis.
+const staffDigestLease = 5 * time.Minute
+
+// Template email staf di TemplateRegistry
+const (
+	staffNotificationTemplate = "template_staff_notification.html"
+	staffDigestTemplate       = "template_staff_digest.html"
+)
+
+// staffEventTitles adalah judul event di email staf
+var staffEventTitles = map[string]string{
+	config.EventContractSigned:   "Kontrak Ditandatangani",
+	config.EventPaymentReceived:  "Pembayaran Diterima",
+	config.EventProcessingFailed: "Webhook Gagal Diproses",
+}
+
+// StaffDigestItem adalah ringkasan satu event untuk staf, dipakai di email instan maupun digest harian
+type StaffDigestItem struct {
+	Description string    `bson:"description" json:"description"`
+	Name        string    `bson:"name,omitempty" json:"name,omitempty"`
+	Email       string    `bson:"email,omitempty" json:"email,omitempty" log:"pii"`
+	Amount      string    `bson:"amount,omitempty" json:"amount,omitempty"`
+	Link        string    `bson:"link,omitempty" json:"link,omitempty"`
+	Error       string    `bson:"error,omitempty" json:"error,omitempty"`
+	OccurredAt  time.Time `bson:"occurred_at" json:"occurred_at"`
+}
+
+// StaffEvent adalah kejadian yang perlu diketahui staf. Email boleh nil, isinya lalu dibuat dari Item
+// dengan template_staff_notification.html. WhatsApp selalu dikirim langsung, tidak ikut digest.
+type StaffEvent struct {
+	Key      string
+	Event    string
+	Type     string // jenis pesan email, kosong berarti nama event
+	Tenant   *config.Tenant
+	Item     StaffDigestItem
+	Email    *EmailPayload
+	WhatsApp *WhatsAppPayload
+}
+
+// staffDigestEntry adalah event staf yang menunggu digest harian
+type staffDigestEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Key        string             `bson:"key"`
+	Event      string             `bson:"event"`
+	TenantID   string             `bson:"tenant_id"`
+	Item       StaffDigestItem    `bson:"item"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	DigestedAt *time.Time         `bson:"digested_at,omitempty"`
+}
+
+// StaffNotificationService mengirim event ke staf sesuai staff_notifications (global atau per tenant):
+// satu email per event, atau dikumpulkan ke digest harian
+type StaffNotificationService struct {
+	notifications *NotificationService
+	digest        *mongo.Collection
+	runs          *mongo.Collection
+	templates     *TemplateRegistry
+	cfg           *config.Config
+	log           *zap.Logger
+}
+
+func NewStaffNotificationService(db *database.Database, notifications *NotificationService, templates *TemplateRegistry, cfg *config.Config, log *zap.Logger) *StaffNotificationService {
+	return &StaffNotificationService{
+		notifications: notifications,
+		digest:        db.DB.Collection(StaffDigestCollection),
+		runs:          db.DB.Collection(StaffDigestRunCollection),
+		templates:     templates,
+		cfg:           cfg,
+		log:           log,
+	}
+}
+
+// Notify mencatat notifikasi staf untuk event bersama notifikasi lain (misalnya untuk siswa) dalam satu kali enqueue
+func (s *StaffNotificationService) Notify(ctx context.Context, e StaffEvent, others ...Notification) error {
+	notifs := others
+	if e.WhatsApp != nil {
+		notifs = append(notifs, Notification{
+			Key:       e.Key,
+			Event:     e.Event,
+			TenantID:  e.Tenant.ID,
+			Recipient: Recipient{Role: config.RoleStaff, Phone: e.WhatsApp.Recipient},
+			WhatsApp:  e.WhatsApp,
+		})
+	}
+
+	recipients := s.cfg.StaffRecipients(e.Tenant, e.Event)
+	switch {
+	case len(recipients.Emails) == 0:
+		logger.FromContext(ctx).Warn("No staff recipients configured", zap.String("event", e.Event), zap.String("tenant", e.Tenant.ID))
+	case recipients.Digest:
+		if err := s.addToDigest(ctx, e); err != nil {
+			return err
+		}
+	default:
+		payload, err := s.staffEmail(e, recipients)
+		if err != nil {
+			return err
+		}
+		for _, email := range recipients.Emails {
+			notifs = append(notifs, Notification{
+				Key:       e.Key,
+				Event:     e.Event,
+				Type:      e.Type,
+				TenantID:  e.Tenant.ID,
+				Recipient: Recipient{Role: config.RoleStaff, Email: email},
+				Email:     &payload,
+			})
+		}
+	}
+
+	return s.notifications.Notify(ctx, notifs...)
+}
+
+// staffEmail menyiapkan email instan tanpa alamat tujuan, alamat diisi per penerima oleh NotificationService
+func (s *StaffNotificationService) staffEmail(e StaffEvent, recipients config.StaffRecipients) (EmailPayload, error) {
+	var payload EmailPayload
+	if e.Email != nil {
+		payload = *e.Email
+	} else {
+		msg, err := s.templates.Render(e.Tenant, staffNotificationTemplate, TemplateData{
+			"Title":  staffEventTitles[e.Event],
+			"Tenant": e.Tenant.Name,
+			"Item":   e.Item,
+		})
+		if err != nil {
+			return EmailPayload{}, err
+		}
+		payload = EmailPayload{
+			Version: EmailPayloadVersion,
+			Type:    "email",
+			Subject: fmt.Sprintf("%s - %s", staffEventTitles[e.Event], e.Tenant.Name),
+			Format:  "html",
+			Msg:     msg,
+		}
+	}
+	payload.To = ""
+	if recipients.Subject != "" {
+		payload.Subject = recipients.Subject
+	}
+	return payload, nil
+}
+
+// addToDigest menyimpan event untuk digest harian, event yang sama hanya dicatat sekali
+func (s *StaffNotificationService) addToDigest(ctx context.Context, e StaffEvent) error {
+	if e.Item.OccurredAt.IsZero() {
+		e.Item.OccurredAt = time.Now()
+	}
+	entry := staffDigestEntry{
+		Key:       e.Key,
+		Event:     e.Event,
+		TenantID:  e.Tenant.ID,
+		Item:      e.Item,
+		CreatedAt: time.Now(),
+	}
+	_, err := s.digest.UpdateOne(ctx,
+		bson.M{"key": e.Key, "event": e.Event},
+		bson.M{"$setOnInsert": entry},
+		options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to add staff digest entry: %v", err)
+	}
+	return nil
+}
+
+// Run mengirim digest setiap hari pada staff_digest_time (WIB) sampai ctx selesai
+func (s *StaffNotificationService) Run(ctx context.Context) {
+	ctx = logger.WithLogger(ctx, s.log)
+	for {
+		next := nextDigestTime(time.Now(), s.cfg.StaffDigestTime)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		if err := s.SendDigest(ctx, next); err != nil {
+			logger.FromContext(ctx).Error("Failed to send staff digest", zap.Error(err))
+		}
+	}
+}
+
+// SendDigest mengirim satu email per tenant dan event berisi semua event yang belum masuk digest
+func (s *StaffNotificationService) SendDigest(ctx context.Context, now time.Time) error {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := s.digest.Find(ctx, bson.M{"digested_at": nil}, opts)
+	if err != nil {
+		return fmt.Errorf("failed to read staff digest: %v", err)
+	}
+	var entries []staffDigestEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return fmt.Errorf("failed to read staff digest: %v", err)
+	}
+
+	type group struct {
+		tenantID, event string
+	}
+	groups := map[group][]staffDigestEntry{}
+	var order []group
+	for _, e := range entries {
+		g := group{e.TenantID, e.Event}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], e)
+	}
+
+	date := now.In(jakarta()).Format("2006-01-02")
+	for _, g := range order {
+		// setiap replica menjalankan Run, hanya yang berhasil mengklaim yang mengirim digest
+		runID := fmt.Sprintf("%s:%s:%s", g.tenantID, g.event, date)
+		claimed, err := s.claimDigest(ctx, runID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.sendDigestGroup(ctx, g.tenantID, g.event, date, groups[g]); err != nil {
+			logger.FromContext(ctx).Error("Failed to send staff digest",
+				zap.String("tenant", g.tenantID), zap.String("event", g.event), zap.Error(err))
+			continue
+		}
+		if _, err := s.runs.UpdateOne(ctx, bson.M{"_id": runID}, bson.M{"$set": bson.M{"sent_at": time.Now()}}); err != nil {
+			logger.FromContext(ctx).Error("Failed to mark staff digest as sent", zap.String("run", runID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// claimDigest mengunci digest untuk satu tenant, event dan tanggal. Upsert dengan filter yang tidak cocok
+// (sudah terkirim atau masih dikunci) gagal dengan duplicate key, sehingga hanya satu replica yang mendapat true.
+func (s *StaffNotificationService) claimDigest(ctx context.Context, runID string) (bool, error) {
+	now := time.Now()
+	_, err := s.runs.UpdateOne(ctx,
+		bson.M{"_id": runID, "sent_at": nil, "locked_until": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"locked_until": now.Add(staffDigestLease)}},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim staff digest: %v", err)
+	}
+	return true, nil
+}
+
+func (s *StaffNotificationService) sendDigestGroup(ctx context.Context, tenantID, event, date string, entries []staffDigestEntry) error {
+	tenant := s.cfg.Tenant(tenantID)
+	if tenant == nil {
+		return fmt.Errorf("unknown tenant %q", tenantID)
+	}
+	recipients := s.cfg.StaffRecipients(tenant, event)
+	if len(recipients.Emails) == 0 {
+		return fmt.Errorf("no staff recipients configured for %s", event)
+	}
+
+	items := make([]StaffDigestItem, len(entries))
+	ids := make([]primitive.ObjectID, len(entries))
+	for i, e := range entries {
+		items[i] = e.Item
+		items[i].OccurredAt = e.Item.OccurredAt.In(jakarta())
+		ids[i] = e.ID
+	}
+	msg, err := s.templates.Render(tenant, staffDigestTemplate, TemplateData{
+		"Title":  staffEventTitles[event],
+		"Tenant": tenant.Name,
+		"Date":   date,
+		"Items":  items,
+	})
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("Ringkasan Harian %s - %s (%s)", staffEventTitles[event], tenant.Name, date)
+	if recipients.Subject != "" {
+		subject = fmt.Sprintf("%s (%s)", recipients.Subject, date)
+	}
+	payload := EmailPayload{Version: EmailPayloadVersion, Type: "email", Subject: subject, Format: "html", Msg: msg}
+
+	notifs := make([]Notification, 0, len(recipients.Emails))
+	for _, email := range recipients.Emails {
+		notifs = append(notifs, Notification{
+			Key:       fmt.Sprintf("digest:%s:%s", tenantID, date),
+			Event:     event,
+			Type:      MessageStaffDigest,
+			TenantID:  tenantID,
+			Recipient: Recipient{Role: config.RoleStaff, Email: email},
+			Email:     &payload,
+		})
+	}
+	if err := s.notifications.Notify(ctx, notifs...); err != nil {
+		return err
+	}
+
+	_, err = s.digest.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"digested_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to mark staff digest entries: %v", err)
+	}
+	logger.FromContext(ctx).Info("Staff digest queued",
+		zap.String("tenant", tenantID), zap.String("event", event), zap.Int("items", len(items)))
+	return nil
+}
+
+// nextDigestTime mengembalikan waktu digest berikutnya setelah now, clock berformat 15:04 (WIB)
+func nextDigestTime(now time.Time, clock string) time.Time {
+	at, err := time.Parse("15:04", clock)
+	if err != nil {
+		at, _ = time.Parse("15:04", "08:00")
+	}
+	local := now.In(jakarta())
+	next := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, local.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// jakarta adalah zona waktu WIB, memakai offset tetap jika tzdata tidak tersedia
+func jakarta() *time.Location {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		return time.FixedZone("WIB", 7*60*60)
+	}
+	return loc
+}
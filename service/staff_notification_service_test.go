@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDigestTime(t *testing.T) {
+	wib := jakarta()
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		clock string
+		want  time.Time
+	}{
+		{"later today", time.Date(2026, 3, 5, 6, 0, 0, 0, wib), "08:00", time.Date(2026, 3, 5, 8, 0, 0, 0, wib)},
+		{"exactly at digest time", time.Date(2026, 3, 5, 8, 0, 0, 0, wib), "08:00", time.Date(2026, 3, 6, 8, 0, 0, 0, wib)},
+		{"after digest time", time.Date(2026, 3, 5, 23, 30, 0, 0, wib), "08:00", time.Date(2026, 3, 6, 8, 0, 0, 0, wib)},
+		{"across month end", time.Date(2026, 2, 28, 9, 0, 0, 0, wib), "08:00", time.Date(2026, 3, 1, 8, 0, 0, 0, wib)},
+		// 20:00 UTC sudah lewat tengah malam di WIB
+		{"utc clock before wib midnight", time.Date(2026, 3, 5, 20, 0, 0, 0, time.UTC), "08:00", time.Date(2026, 3, 6, 8, 0, 0, 0, wib)},
+		{"digest just after midnight", time.Date(2026, 3, 5, 23, 59, 0, 0, wib), "00:05", time.Date(2026, 3, 6, 0, 5, 0, 0, wib)},
+		{"invalid clock falls back to 08:00", time.Date(2026, 3, 5, 6, 0, 0, 0, wib), "8 pagi", time.Date(2026, 3, 5, 8, 0, 0, 0, wib)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDigestTime(tt.now, tt.clock); !got.Equal(tt.want) {
+				t.Errorf("nextDigestTime(%v, %q) = %v, want %v", tt.now, tt.clock, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/templates"
+)
+
+// TemplateData adalah data untuk semua template email, key-nya dipakai langsung di template ({{ .RecipientName }})
+type TemplateData map[string]interface{}
+
+// TemplateRegistry menyimpan template email yang sudah di-parse saat startup. Template bawaan di-embed
+// ke binary, file .html di template_dir tenant menimpa template bawaan dengan nama yang sama.
+type TemplateRegistry struct {
+	base    *template.Template
+	tenants map[string]*template.Template
+}
+
+// templateFuncs adalah helper yang tersedia di semua template
+var templateFuncs = template.FuncMap{
+	"rupiah":     templateRupiah,
+	"tanggal":    templateTanggal,
+	"tanggalJam": templateTanggalJam,
+}
+
+// NewTemplateRegistry mem-parse template bawaan dan template tenant, error jika ada template yang tidak bisa dikompilasi
+func NewTemplateRegistry(cfg *config.Config) (*TemplateRegistry, error) {
+	base, err := template.New("").Funcs(templateFuncs).ParseFS(templates.FS, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse embedded templates: %v", err)
+	}
+
+	r := &TemplateRegistry{base: base, tenants: map[string]*template.Template{}}
+	for i := range cfg.Tenants {
+		t := &cfg.Tenants[i]
+		files, _ := filepath.Glob(t.TemplatePath("*.html"))
+		if len(files) == 0 {
+			continue
+		}
+		set, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: failed to read template %s: %v", t.ID, file, err)
+			}
+			if _, err := set.New(filepath.Base(file)).Parse(string(content)); err != nil {
+				return nil, fmt.Errorf("tenant %s: failed to parse template %s: %v", t.ID, file, err)
+			}
+		}
+		r.tenants[t.ID] = set
+	}
+	return r, nil
+}
+
+// set mengembalikan template milik tenant, atau template bawaan jika tenant tidak punya override
+func (r *TemplateRegistry) set(t *config.Tenant) *template.Template {
+	if t != nil {
+		if set, ok := r.tenants[t.ID]; ok {
+			return set
+		}
+	}
+	return r.base
+}
+
+// Names mengembalikan nama semua template yang tersedia untuk tenant
+func (r *TemplateRegistry) Names(t *config.Tenant) []string {
+	var names []string
+	for _, tmpl := range r.set(t).Templates() {
+		if strings.HasSuffix(tmpl.Name(), ".html") {
+			names = append(names, tmpl.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has bernilai true jika template email (file .html) dengan nama tersebut ada
+func (r *TemplateRegistry) Has(t *config.Tenant, name string) bool {
+	return strings.HasSuffix(name, ".html") && r.set(t).Lookup(name) != nil
+}
+
+// Render merender template dengan data, t boleh nil untuk memakai template bawaan
+func (r *TemplateRegistry) Render(t *config.Tenant, name string, data interface{}) (string, error) {
+	tmpl := r.set(t).Lookup(name)
+	if tmpl == nil {
+		return "", fmt.Errorf("unknown email template %q", name)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render email template %s: %v", name, err)
+	}
+	return rendered.String(), nil
+}
+
+// BuildEmail merender template dan membentuk payload email, dipakai untuk outbox atau dikirim langsung
+func (r *TemplateRegistry) BuildEmail(t *config.Tenant, to string, subject string, name string, data interface{}) (EmailPayload, error) {
+	msg, err := r.Render(t, name, data)
+	if err != nil {
+		return EmailPayload{}, err
+	}
+	return EmailPayload{
+		Version: EmailPayloadVersion,
+		Type:    "email",
+		Subject: subject,
+		To:      to,
+		Format:  "html",
+		Msg:     msg,
+	}, nil
+}
+
+// FormatRupiah menulis nominal dengan pemisah ribuan titik, misalnya Rp 6.250.000
+func FormatRupiah(amount float64) string {
+	digits := strconv.FormatInt(int64(amount), 10)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+	return "Rp " + sign + b.String()
+}
+
+var bulanIndonesia = [...]string{"Januari", "Februari", "Maret", "April", "Mei", "Juni", "Juli",
+	"Agustus", "September", "Oktober", "November", "Desember"}
+
+// FormatTanggal menulis tanggal dalam bahasa Indonesia (WIB), misalnya 5 Maret 2026
+func FormatTanggal(t time.Time) string {
+	t = t.In(jakarta())
+	return fmt.Sprintf("%d %s %d", t.Day(), bulanIndonesia[t.Month()-1], t.Year())
+}
+
+// FormatTanggalJam menulis tanggal dan jam dalam bahasa Indonesia, misalnya 5 Maret 2026 14:30 WIB
+func FormatTanggalJam(t time.Time) string {
+	local := t.In(jakarta())
+	return fmt.Sprintf("%s %02d:%02d WIB", FormatTanggal(t), local.Hour(), local.Minute())
+}
+
+// templateRupiah menerima angka atau string angka; string lain (nominal yang sudah diformat) dikembalikan apa adanya
+func templateRupiah(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return FormatRupiah(n)
+	case float32:
+		return FormatRupiah(float64(n))
+	case int:
+		return FormatRupiah(float64(n))
+	case int64:
+		return FormatRupiah(float64(n))
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return FormatRupiah(f)
+		}
+		return n
+	}
+	return fmt.Sprint(v)
+}
+
+// templateTime menerima time.Time, *time.Time atau string RFC 3339
+func templateTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, !t.IsZero()
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func templateTanggal(v interface{}) string {
+	if t, ok := templateTime(v); ok {
+		return FormatTanggal(t)
+	}
+	return fmt.Sprint(v)
+}
+
+func templateTanggalJam(v interface{}) string {
+	if t, ok := templateTime(v); ok {
+		return FormatTanggalJam(t)
+	}
+	return fmt.Sprint(v)
+}
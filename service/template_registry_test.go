@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatRupiah(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "Rp 0"},
+		{500, "Rp 500"},
+		{1000, "Rp 1.000"},
+		{250000, "Rp 250.000"},
+		{6250000, "Rp 6.250.000"},
+		{1500.75, "Rp 1.500"},
+		{-500, "Rp -500"},
+		{-1000, "Rp -1.000"},
+		{-250000, "Rp -250.000"},
+		{-6250000, "Rp -6.250.000"},
+		{-0.5, "Rp 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatRupiah(tt.amount); got != tt.want {
+				t.Errorf("FormatRupiah(%v) = %q, want %q", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTanggal(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2026, 3, 5, 10, 0, 0, 0, jakarta()), "5 Maret 2026"},
+		// 18:00 UTC sudah tanggal berikutnya di WIB
+		{time.Date(2026, 12, 31, 18, 0, 0, 0, time.UTC), "1 Januari 2027"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatTanggal(tt.t); got != tt.want {
+			t.Errorf("FormatTanggal(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
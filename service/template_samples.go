@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"webhook-listener-mekarisign/config"
+)
+
+// SampleData mengembalikan contoh data untuk preview template, mengikuti data yang diisi saat email asli dibuat.
+// Template tenant yang tidak dikenal mendapat data umum (nama, subject, link, nominal).
+func (r *TemplateRegistry) SampleData(t *config.Tenant, name string) TemplateData {
+	tenantName := "LPK Contoh"
+	if t != nil {
+		tenantName = t.Name
+	}
+	now := time.Now()
+	item := StaffDigestItem{
+		Description: fmt.Sprintf("Pendaftaran %s - Pembayaran ke-1", tenantName),
+		Name:        "Budi Santoso",
+		Email:       "budi.santoso@example.com",
+		Amount:      FormatRupiah(6250000),
+		Link:        "https://checkout.xendit.co/web/contoh",
+		OccurredAt:  now.In(jakarta()),
+	}
+
+	switch name {
+	case "template_send_email_receipt.html":
+		return TemplateData{
+			"RecipientName": item.Name,
+			"Number":        fmt.Sprintf("KW/CONTOH/%d/000001", now.Year()),
+			"Description":   item.Description,
+			"Amount":        6250000.0,
+			"PaidAt":        now,
+			"Tenant":        tenantName,
+		}
+	case staffNotificationTemplate:
+		return TemplateData{
+			"Title":  staffEventTitles[config.EventPaymentReceived],
+			"Tenant": tenantName,
+			"Item":   item,
+		}
+	case staffDigestTemplate:
+		failed := item
+		failed.Description = "Pembuatan invoice Xendit"
+		failed.Amount = ""
+		failed.Link = ""
+		failed.Error = "xendit: request timeout"
+		return TemplateData{
+			"Title":  staffEventTitles[config.EventPaymentReceived],
+			"Tenant": tenantName,
+			"Date":   now.In(jakarta()).Format("2006-01-02"),
+			"Items":  []StaffDigestItem{item, failed},
+		}
+	}
+
+	return TemplateData{
+		"To":            item.Email,
+		"Subject":       item.Description,
+		"RecipientName": item.Name,
+		"Link":          item.Link,
+		"DueDate":       "beberapa hari kedepan",
+		"InvoiceID":     item.Link,
+		"Amount":        6250000.0,
+	}
+}
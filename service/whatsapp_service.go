@@ -2,10 +2,17 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
+
 	"webhook-listener-mekarisign/config"
+	"webhook-listener-mekarisign/metrics"
+	"webhook-listener-mekarisign/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // WhatsAppPayload struct untuk request body
@@ -18,8 +25,15 @@ type WhatsAppPayload struct {
 	EnabledSchedule int      `json:"enabled_schedule"`
 }
 
+// whatsappClient dipakai bersama dan meneruskan correlation ID serta trace context dari context
+var whatsappClient = newHTTPClient(30 * time.Second)
+
 // SendWhatsAppMessage mengirim pesan ke API WhatsApp
-func SendWhatsAppMessage(cfg *config.Config, payload WhatsAppPayload) error {
+func SendWhatsAppMessage(ctx context.Context, cfg *config.Config, payload WhatsAppPayload) (err error) {
+	defer metrics.ObserveCall(metrics.WhatsApp, "send_message", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "whatsapp.SendMessage", attribute.String("template_id", payload.TemplateID))
+	defer tracing.End(span, &err)
+
 	url := "https://wapi.wkwk-japanese.com/api/queue"
 
 	// Konversi payload ke JSON
@@ -29,7 +43,7 @@ func SendWhatsAppMessage(cfg *config.Config, payload WhatsAppPayload) error {
 	}
 
 	// Buat request HTTP
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
@@ -39,8 +53,7 @@ func SendWhatsAppMessage(cfg *config.Config, payload WhatsAppPayload) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Kirim request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := whatsappClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %v", err)
 	}
@@ -2,16 +2,25 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
 	"webhook-listener-mekarisign/logger"
+	"webhook-listener-mekarisign/metrics"
+	"webhook-listener-mekarisign/tracing"
 
 	"webhook-listener-mekarisign/config"
 
 	xendit "github.com/xendit/xendit-go/v6"
 	invoice "github.com/xendit/xendit-go/v6/invoice"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+const (
+	listInvoicesPageSize = 100
+	xenditTimeout        = 30 * time.Second
 )
 
 type XenditService struct {
@@ -36,6 +45,31 @@ type CustomerObject struct {
 	CustomerId string `json:"customer_id,omitempty"`
 }
 
+// InvoiceItem adalah satu baris rincian yang ditampilkan di halaman invoice Xendit
+type InvoiceItem struct {
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+	Category string  `json:"category,omitempty"`
+}
+
+// InvoiceFee adalah biaya tambahan pada invoice, nilai negatif dipakai untuk potongan
+type InvoiceFee struct {
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+}
+
+// InvoiceOptions berisi parameter opsional untuk CreateInvoice
+type InvoiceOptions struct {
+	Items              []InvoiceItem
+	Fees               []InvoiceFee
+	PaymentMethods     []string
+	SuccessRedirectURL string
+	FailureRedirectURL string
+	Locale             string
+	Metadata           map[string]interface{}
+}
+
 func StringPtr(s string) *string {
 	if s == "" {
 		return nil // Menghindari pointer ke string kosong
@@ -44,16 +78,32 @@ func StringPtr(s string) *string {
 }
 
 func NewXenditService(cfg *config.Config) *XenditService {
-	client := xendit.NewClient(cfg.XenditSecretKey)
+	return NewXenditServiceWithKey(cfg.XenditSecretKey)
+}
+
+func NewXenditServiceWithKey(secretKey string) *XenditService {
+	client := xendit.NewClient(secretKey)
+	// correlation ID dan trace context dari context ikut dikirim ke Xendit
+	client.GetConfig().(*xendit.Configuration).HTTPClient = newHTTPClient(xenditTimeout)
 	return &XenditService{
 		client: client,
-		apiKey: cfg.XenditSecretKey,
+		apiKey: secretKey,
+	}
+}
+
+// NewTenantXenditServices membuat XenditService untuk setiap tenant, dengan key berupa ID tenant
+func NewTenantXenditServices(cfg *config.Config) map[string]*XenditService {
+	services := make(map[string]*XenditService, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		services[t.ID] = NewXenditServiceWithKey(t.XenditSecretKey)
 	}
+	return services
 }
 
-func (xs *XenditService) CreateInvoice(externalID, payerEmail string, description string, customerData *CustomerObject, invDuration string, amount float64, forUserID string) (*invoice.Invoice, error) {
-	logger := logger.NewLogger()
-	defer logger.Sync()
+func (xs *XenditService) CreateInvoice(ctx context.Context, externalID, payerEmail string, description string, customerData *CustomerObject, invDuration string, amount float64, forUserID string, opts *InvoiceOptions) (_ *invoice.Invoice, err error) {
+	defer metrics.ObserveCall(metrics.Xendit, "create_invoice", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "xendit.CreateInvoice", attribute.String("external_id", externalID))
+	defer tracing.End(span, &err)
 
 	customer := &invoice.CustomerObject{
 		PhoneNumber:  *invoice.NewNullableString(StringPtr(customerData.PhoneNumber)),
@@ -77,20 +127,156 @@ func (xs *XenditService) CreateInvoice(externalID, payerEmail string, descriptio
 	createInvoiceRequest.Customer = customer
 	createInvoiceRequest.InvoiceDuration = &invDuration
 
-	resp, r, err := xs.client.InvoiceApi.CreateInvoice(context.Background()).
+	if opts != nil {
+		for _, item := range opts.Items {
+			xItem := invoice.NewInvoiceItem(item.Name, float32(item.Price), float32(item.Quantity))
+			xItem.Category = StringPtr(item.Category)
+			createInvoiceRequest.Items = append(createInvoiceRequest.Items, *xItem)
+		}
+		for _, fee := range opts.Fees {
+			createInvoiceRequest.Fees = append(createInvoiceRequest.Fees, *invoice.NewInvoiceFee(fee.Type, float32(fee.Value)))
+		}
+		createInvoiceRequest.PaymentMethods = opts.PaymentMethods
+		createInvoiceRequest.SuccessRedirectUrl = StringPtr(opts.SuccessRedirectURL)
+		createInvoiceRequest.FailureRedirectUrl = StringPtr(opts.FailureRedirectURL)
+		createInvoiceRequest.Locale = StringPtr(opts.Locale)
+		createInvoiceRequest.Metadata = opts.Metadata
+	}
+
+	resp, r, xerr := xs.client.InvoiceApi.CreateInvoice(ctx).
 		CreateInvoiceRequest(createInvoiceRequest).
 		ForUserId(forUserID). // [OPTIONAL] Business ID for sub-account merchants
 		Execute()
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error when calling `InvoiceApi.CreateInvoice`: %v\n", err.Error())
+	if xerr != nil {
+		// lewat logger agar data customer di respons error ikut disamarkan
+		status := 0
+		if r != nil {
+			status = r.StatusCode
+		}
+		logger.FromContext(ctx).Error("Error when calling InvoiceApi.CreateInvoice",
+			zap.Error(xerr), zap.Any("full_error", xerr.FullError()), zap.Int("http_status", status))
+		return nil, xerr
+	}
+
+	return resp, nil
+}
+
+// ListInvoices mengambil semua invoice sejak createdAfter yang external ID-nya diawali salah satu prefix
+func (xs *XenditService) ListInvoices(ctx context.Context, createdAfter time.Time, prefixes []string) (_ []invoice.Invoice, err error) {
+	defer metrics.ObserveCall(metrics.Xendit, "list_invoices", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "xendit.ListInvoices")
+	defer tracing.End(span, &err)
+
+	var result []invoice.Invoice
+	lastInvoice := ""
+
+	for {
+		req := xs.client.InvoiceApi.GetInvoices(ctx).
+			CreatedAfter(createdAfter).
+			Limit(listInvoicesPageSize)
+		if lastInvoice != "" {
+			req = req.LastInvoice(lastInvoice)
+		}
+
+		page, _, xerr := req.Execute()
+		if xerr != nil {
+			return nil, fmt.Errorf("failed to list invoices: %v", xerr.Error())
+		}
+
+		for _, inv := range page {
+			if hasAnyPrefix(inv.ExternalId, prefixes) {
+				result = append(result, inv)
+			}
+		}
 
-		b, _ := json.Marshal(err.FullError())
-		fmt.Fprintf(os.Stderr, "Full Error Struct: %v\n", string(b))
+		if len(page) < listInvoicesPageSize || page[len(page)-1].Id == nil {
+			break
+		}
+		lastInvoice = *page[len(page)-1].Id
+	}
+
+	return result, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInvoice mengambil detail invoice berdasarkan ID invoice Xendit
+func (xs *XenditService) GetInvoice(ctx context.Context, invoiceID string) (_ *invoice.Invoice, err error) {
+	defer metrics.ObserveCall(metrics.Xendit, "get_invoice", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "xendit.GetInvoice", attribute.String("invoice_id", invoiceID))
+	defer tracing.End(span, &err)
+
+	resp, _, xerr := xs.client.InvoiceApi.GetInvoiceById(ctx, invoiceID).Execute()
+	if xerr != nil {
+		return nil, fmt.Errorf("failed to get invoice: %v", xerr.Error())
+	}
+	return resp, nil
+}
+
+// FindInvoiceByExternalID mengambil invoice terbaru dengan external ID tersebut, nil jika belum ada
+func (xs *XenditService) FindInvoiceByExternalID(ctx context.Context, externalID string) (_ *invoice.Invoice, err error) {
+	defer metrics.ObserveCall(metrics.Xendit, "find_invoice", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "xendit.FindInvoiceByExternalID", attribute.String("external_id", externalID))
+	defer tracing.End(span, &err)
 
-		fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-		return nil, err
+	invoices, _, xerr := xs.client.InvoiceApi.GetInvoices(ctx).ExternalId(externalID).Execute()
+	if xerr != nil {
+		return nil, fmt.Errorf("failed to find invoice: %v", xerr.Error())
 	}
+	if len(invoices) == 0 {
+		return nil, nil
+	}
+	latest := invoices[0]
+	for _, inv := range invoices[1:] {
+		if inv.Created.After(latest.Created) {
+			latest = inv
+		}
+	}
+	return &latest, nil
+}
+
+// Ping memastikan API Xendit bisa dihubungi dan secret key valid dengan mengambil saldo akun
+func (xs *XenditService) Ping(ctx context.Context) error {
+	_, _, xerr := xs.client.BalanceApi.GetBalance(ctx).Execute()
+	if xerr != nil {
+		return fmt.Errorf("xendit unreachable: %v", xerr.Error())
+	}
+	return nil
+}
 
+// ExpireInvoice membatalkan invoice yang belum dibayar sehingga link pembayarannya tidak bisa dipakai lagi
+func (xs *XenditService) ExpireInvoice(ctx context.Context, invoiceID string) (_ *invoice.Invoice, err error) {
+	defer metrics.ObserveCall(metrics.Xendit, "expire_invoice", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "xendit.ExpireInvoice", attribute.String("invoice_id", invoiceID))
+	defer tracing.End(span, &err)
+
+	resp, _, xerr := xs.client.InvoiceApi.ExpireInvoice(ctx, invoiceID).Execute()
+	if xerr != nil {
+		return nil, fmt.Errorf("failed to expire invoice: %v", xerr.Error())
+	}
 	return resp, nil
 }
+
+// CustomerFromInvoice mengubah customer pada invoice Xendit menjadi CustomerObject
+func CustomerFromInvoice(inv *invoice.Invoice) *CustomerObject {
+	if inv.Customer == nil {
+		return &CustomerObject{}
+	}
+	return &CustomerObject{
+		Id:           inv.Customer.GetId(),
+		PhoneNumber:  inv.Customer.GetPhoneNumber(),
+		GivenNames:   inv.Customer.GetGivenNames(),
+		Surname:      inv.Customer.GetSurname(),
+		Email:        inv.Customer.GetEmail(),
+		MobileNumber: inv.Customer.GetMobileNumber(),
+		CustomerId:   inv.Customer.GetCustomerId(),
+	}
+}
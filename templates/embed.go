@@ -0,0 +1,8 @@
+// Package templates berisi template email bawaan yang ikut di-embed ke binary.
+// File dengan nama yang sama di template_dir tenant menimpa versi bawaan.
+package templates
+
+import "embed"
+
+//go:embed *.html
+var FS embed.FS